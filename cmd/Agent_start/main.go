@@ -1,11 +1,19 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
 )
 
 func main() {
 	//app.Run() // Используется для проверки работы калькулятора без сервера: тут будем чиать введенную строку и после нажатия ENTER писать результат работы программы на экране, exit - останавливает приложение
-	app := application.NewAgent()
+	cfg := application.AgentConfigFromEnv()
+	flag.StringVar(&cfg.OrchestratorAddr, "orchestrator", cfg.OrchestratorAddr, "адрес gRPC-сервера оркестратора (ORCHESTRATOR_ADDR)")
+	flag.StringVar(&cfg.ID, "id", cfg.ID, "ID агента (AGENT_ID)")
+	flag.IntVar(&cfg.ComputingPower, "computing-power", cfg.ComputingPower, "количество горутин (COMPUTING_POWER)")
+	flag.Parse()
+
+	app := application.NewAgent(cfg)
 	app.RunAgent()
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"log"
 
 	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
@@ -10,9 +11,6 @@ import (
 )
 
 func main() {
-	var (
-		idnum int
-	)
 	ctx := context.TODO()
 
 	db, err := sql.Open("sqlite3", "store.db")
@@ -29,45 +27,23 @@ func main() {
 	}
 
 	app := application.NewOrchestrator(db, ctx)
-	app.CreateTables()
-	rows, err := db.QueryContext(
-		app.Ctx,
-		`SELECT id, expression, jwt, user_lg, status, result FROM expressions`,
-	)
-	if err != nil {
+	flag.StringVar(&app.Config.Addr, "port", app.Config.Addr, "HTTP-порт (PORT)")
+	flag.StringVar(&app.Config.GrpcAddr, "grpc-addr", app.Config.GrpcAddr, "адрес gRPC-сервера для агентов (GRPC_ADDR)")
+	flag.BoolVar(&app.Config.EmbeddedAgent, "embedded-agent", app.Config.EmbeddedAgent, "запускать агента внутри оркестратора (EMBEDDED_AGENT)")
+	flag.Parse()
+
+	if err = app.CreateTables(); err != nil {
 		log.Fatal(err)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var expr *application.Expression = &application.Expression{}
-		if err = rows.Scan(
-			&expr.ID,
-			&expr.Expr,
-			&expr.Jwt,
-			&expr.Login,
-			&expr.Status,
-			&expr.Result,
-		); err != nil {
-			log.Fatal(err)
-		}
-
-		app.ExprStore[expr.ID] = expr
-
-		if expr.Status != "completed" {
-			app.Tasks(expr)
-		}
 
+	// Кэш результатов (если CACHE_PERSIST=true), затем выражения, деревья и задачи, сохраненные до остановки
+	if err = app.LoadCache(); err != nil {
+		log.Fatal(err)
 	}
 
-	if err = app.Db.QueryRowContext(
-		app.Ctx,
-		`SELECT COUNT(id) FROM expressions`,
-	).Scan(&idnum); err != nil {
+	if err = app.LoadExpressions(); err != nil {
 		log.Fatal(err)
 	}
 
-	app.ExprCounter = idnum
-
 	app.RunOrchestrator()
 }
@@ -2,16 +2,23 @@ package application
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
 	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type AgentTask struct {
@@ -29,20 +36,58 @@ type AgentResJSON struct {
 	Result float64 `json:"result,omitempty"`
 }
 
-type Agent struct {
-	ComputingPower int
-	grpcClient     pb.OrchestratorAgentServiceClient
+// Коды ошибок, которые агент передает оркестратору вместо результата
+const (
+	ErrCodeDivisionByZero  = "DIVISION_BY_ZERO"
+	ErrCodeUnknownOperator = "UNKNOWN_OPERATOR"
+	ErrCodeOutOfDomain     = "OUT_OF_DOMAIN"
+	ErrCodeInternal        = "INTERNAL"
+)
+
+type AgentConfig struct {
+	ID               string
+	OrchestratorAddr string
+	ComputingPower   int
+	Labels           map[string]string
 }
 
-func NewAgent() *Agent {
+func AgentConfigFromEnv() *AgentConfig {
+	id := os.Getenv("AGENT_ID")
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	addr := os.Getenv("ORCHESTRATOR_ADDR")
+	if addr == "" {
+		addr = "localhost:9090"
+	}
 	cp, err := strconv.Atoi(os.Getenv("COMPUTING_POWER"))
 	if err != nil || cp < 1 {
 		cp = 1
 	}
 
-	grpcAddr := "localhost:9090"
+	return &AgentConfig{
+		ID:               id,
+		OrchestratorAddr: addr,
+		ComputingPower:   cp,
+		Labels:           parseLabels(os.Getenv("AGENT_LABELS")),
+	}
+}
 
-	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+type Agent struct {
+	ID             string
+	Labels         map[string]string
+	ComputingPower int
+	instance       string // случайный ID процесса, см. agentInstanceKey
+	grpcClient     pb.OrchestratorAgentServiceClient
+}
+
+func NewAgent(cfg *AgentConfig) *Agent {
+	if cfg.ComputingPower < 1 {
+		cfg.ComputingPower = 1
+	}
+
+	conn, err := grpc.NewClient(cfg.OrchestratorAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -50,31 +95,179 @@ func NewAgent() *Agent {
 	client := pb.NewOrchestratorAgentServiceClient(conn)
 
 	return &Agent{
-		ComputingPower: cp,
+		ID:             cfg.ID,
+		Labels:         cfg.Labels,
+		ComputingPower: cfg.ComputingPower,
+		instance:       randomHex(8),
 		grpcClient:     client,
 	}
 }
 
+// parseLabels разбирает метки вида "zone=a,gpu=no"
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if k != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// ctx - контекст запросов к оркестратору, по ID в метаданных он узнает агента
+func (a *Agent) ctx() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), agentIDKey, a.ID, agentInstanceKey, a.instance)
+}
+
+// register регистрирует агента и возвращает интервал heartbeat
+func (a *Agent) register() (time.Duration, error) {
+	rs, err := a.grpcClient.Register(a.ctx(), &pb.RegisterRequest{AgentId: a.ID, Labels: a.Labels, Capacity: int32(a.ComputingPower)})
+	if err != nil {
+		return 0, err
+	}
+
+	interval := time.Duration(rs.HeartbeatIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval, nil
+}
+
+// heartbeat регистрирует агента и сообщает оркестратору, что агент жив
+func (a *Agent) heartbeat() {
+	var (
+		interval time.Duration
+		err      error
+	)
+
+	for {
+		if interval == 0 {
+			if interval, err = a.register(); err != nil {
+				if status.Code(err) == codes.Unimplemented {
+					log.Println("Orchestrator does not support agent registration")
+					return
+				}
+				log.Printf("Agent registration error: %v. Retrying in 2 seconds...", err)
+				time.Sleep(2 * time.Second)
+				continue
+			}
+			log.Printf("Agent %s registered", a.ID)
+		}
+
+		time.Sleep(interval)
+
+		if _, err = a.grpcClient.Heartbeat(a.ctx(), &pb.HeartbeatRequest{AgentId: a.ID}); err != nil {
+			log.Printf("Heartbeat error: %v", err)
+			if status.Code(err) == codes.NotFound {
+				interval = 0
+			}
+		}
+	}
+}
+
 func (a *Agent) worker() {
 	for {
-		task, err := a.grpcClient.Get(context.Background(), &pb.Empty{})
+		task, err := a.grpcClient.Get(a.ctx(), &pb.Empty{})
 		if err != nil {
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
 
-		log.Printf("Worker: received task %s: %f %s %f, simulating %d ms", task.Id, task.Arg1, task.Operation, task.Arg2, task.OperationTime)
-		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
-		result, _ := calculator(task.Operation, task.Arg1, task.Arg2)
+		_, err = a.grpcClient.Post(a.ctx(), compute(task))
+		if err != nil {
+			log.Printf("Worker: result of task %s rejected: %v", task.Id, err)
+		}
+	}
+}
+
+// stream получает задачи через потоковый канал и раздает их ComputingPower горутинам
+func (a *Agent) stream() error {
+	ctx, cancel := context.WithCancel(a.ctx())
+	defer cancel()
+
+	stream, err := a.grpcClient.Connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	hello := &pb.Hello{AgentId: a.ID, Capacity: int32(a.ComputingPower)}
+	if err = stream.Send(&pb.AgentMessage{Payload: &pb.AgentMessage_Hello{Hello: hello}}); err != nil {
+		return err
+	}
+
+	var (
+		wg     sync.WaitGroup
+		sendMu sync.Mutex
+		tasks  = make(chan *pb.GetResponse)
+	)
+
+	for i := 0; i < a.ComputingPower; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				req := compute(task)
+
+				sendMu.Lock()
+				err := stream.Send(&pb.AgentMessage{Payload: &pb.AgentMessage_Result{Result: req}})
+				sendMu.Unlock()
+
+				if err != nil {
+					log.Printf("Worker: sending result of task %s error: %v", task.Id, err)
+				}
+			}
+		}()
+	}
+
+	defer func() {
+		close(tasks)
+		wg.Wait()
+	}()
 
-		_, err = a.grpcClient.Post(context.Background(), &pb.PostRequest{Id: task.Id, Result: result})
+	for {
+		msg, err := stream.Recv()
 		if err != nil {
-			log.Fatal(err)
-			return
+			return err
+		}
+
+		if msg.Task != nil {
+			tasks <- msg.Task
 		}
 	}
 }
 
+// compute имитирует долгую операцию и считает задачу
+func compute(task *pb.GetResponse) *pb.PostRequest {
+	var (
+		result float64
+		exact  string
+		err    error
+	)
+	if isExact(task.Precision) {
+		log.Printf("Worker: received %s task %s: %s%v, simulating %d ms", task.Precision, task.Id, task.Operation, task.ExactArgs, task.OperationTime)
+		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+		if exact, err = exactCalculator(task.Operation, task.ExactArgs, task.Precision, int(task.Scale)); err == nil {
+			result = exactFloat(exact)
+		}
+	} else if len(task.Args) > 0 {
+		log.Printf("Worker: received task %s: %s%v, simulating %d ms", task.Id, task.Operation, task.Args, task.OperationTime)
+		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+		result, err = calculateFunc(task.Operation, task.Args)
+	} else {
+		log.Printf("Worker: received task %s: %f %s %f, simulating %d ms", task.Id, task.Arg1, task.Operation, task.Arg2, task.OperationTime)
+		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+		result, err = calculator(task.Operation, task.Arg1, task.Arg2)
+	}
+
+	req := &pb.PostRequest{Id: task.Id, Result: result, LeaseId: task.LeaseId, ExactResult: exact}
+	if err != nil {
+		req.Error = taskError(err)
+	}
+
+	return req
+}
+
 func calculator(operator string, arg1, arg2 float64) (float64, error) {
 	var result float64
 
@@ -90,13 +283,43 @@ func calculator(operator string, arg1, arg2 float64) (float64, error) {
 			return 0, errorStore.DvsByZeroErr
 		}
 		result = arg1 / arg2
+	case operator == "%":
+		if arg2 == 0 {
+			return 0, errorStore.DvsByZeroErr
+		}
+		result = math.Mod(arg1, arg2)
+	case operator == "//":
+		if arg2 == 0 {
+			return 0, errorStore.DvsByZeroErr
+		}
+		result = math.Floor(arg1 / arg2)
+	case operator == "^":
+		result = math.Pow(arg1, arg2)
+		// (-8)^0.5, 0^-1 и т.п. не дают вещественного числа
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return 0, errorStore.OutOfDomainErr
+		}
 	default:
-		return 0, fmt.Errorf("Error")
+		return 0, errorStore.UnknownOperatorErr
 	}
 
 	return result, nil
 }
 
+func taskError(err error) *pb.TaskError {
+	code := ErrCodeInternal
+	switch {
+	case errors.Is(err, errorStore.DvsByZeroErr):
+		code = ErrCodeDivisionByZero
+	case errors.Is(err, errorStore.UnknownOperatorErr):
+		code = ErrCodeUnknownOperator
+	case errors.Is(err, errorStore.OutOfDomainErr):
+		code = ErrCodeOutOfDomain
+	}
+
+	return &pb.TaskError{Code: code, Message: err.Error()}
+}
+
 /*
 func (a *Agent) SendResult(request *AgentTask, result []byte) {
 
@@ -132,9 +355,22 @@ func (a *Agent) SendResult(request *AgentTask, result []byte) {
 */
 
 func (a *Agent) RunAgent() {
-	for i := 0; i < a.ComputingPower; i++ {
-		log.Printf("Starting worker %d", i)
-		go a.worker()
+	go a.heartbeat()
+
+	for {
+		err := a.stream()
+		if status.Code(err) != codes.Unimplemented {
+			log.Printf("Task stream closed: %v. Reconnecting in 2 seconds...", err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		// Старый оркестратор без потокового канала - опрашиваем Get
+		log.Println("Orchestrator does not support task streaming, polling instead")
+		for i := 0; i < a.ComputingPower; i++ {
+			log.Printf("Starting worker %d", i)
+			go a.worker()
+		}
+		select {}
 	}
-	select {}
 }
@@ -136,6 +136,62 @@ func TestCalculations(t *testing.T) {
 			expectErr: true,
 		},
 
+		{
+			name:      "Modulo",
+			operation: "%",
+			arg1:      7.0,
+			arg2:      3.0,
+			expected:  1.0,
+			expectErr: false,
+		},
+		{
+			name:      "Modulo by zero",
+			operation: "%",
+			arg1:      7.0,
+			arg2:      0.0,
+			expected:  0.0,
+			expectErr: true,
+		},
+		{
+			name:      "Integer division",
+			operation: "//",
+			arg1:      7.0,
+			arg2:      2.0,
+			expected:  3.0,
+			expectErr: false,
+		},
+		{
+			name:      "Integer division rounds down",
+			operation: "//",
+			arg1:      -7.0,
+			arg2:      2.0,
+			expected:  -4.0,
+			expectErr: false,
+		},
+		{
+			name:      "Integer division by zero",
+			operation: "//",
+			arg1:      7.0,
+			arg2:      0.0,
+			expected:  0.0,
+			expectErr: true,
+		},
+		{
+			name:      "Power",
+			operation: "^",
+			arg1:      2.0,
+			arg2:      10.0,
+			expected:  1024.0,
+			expectErr: false,
+		},
+		{
+			name:      "Fractional power of negative number",
+			operation: "^",
+			arg1:      -8.0,
+			arg2:      0.5,
+			expected:  0.0,
+			expectErr: true,
+		},
 		{
 			name:      "Invalid operator",
 			operation: "invalid",
@@ -166,3 +222,93 @@ func TestCalculations(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateFunc(t *testing.T) {
+	if result, err := calculateFunc("max", []float64{1, 5, 3}); err != nil || result != 5 {
+		t.Errorf("max: expected 5, got %v, %v", result, err)
+	}
+
+	if result, err := calculateFunc("round", []float64{1.2345, 2}); err != nil || result != 1.23 {
+		t.Errorf("round: expected 1.23, got %v, %v", result, err)
+	}
+
+	if result, err := calculateFunc("round", []float64{1.5, 1e9}); err != nil || result != 1.5 {
+		t.Errorf("round: expected 1.5, got %v, %v", result, err)
+	}
+
+	if result, err := calculateFunc("round", []float64{1234.5, -1e9}); err != nil || result != 0 {
+		t.Errorf("round: expected 0, got %v, %v", result, err)
+	}
+
+	for _, args := range [][]float64{{-1}, {}} {
+		if _, err := calculateFunc("sqrt", args); err == nil {
+			t.Errorf("sqrt%v: expected error", args)
+		}
+	}
+
+	if _, err := calculateFunc("log", []float64{0}); err == nil {
+		t.Error("log(0): expected error")
+	}
+}
+
+func TestExactCalculator(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		args      []string
+		precision string
+		scale     int
+		expected  string
+		expectErr bool
+	}{
+		{"Decimal addition", "+", []string{"0.1", "0.2"}, PrecisionDecimal, 2, "3/10", false},
+		{"Decimal division rounds to scale", "/", []string{"1", "3"}, PrecisionDecimal, 4, "3333/10000", false},
+		{"Decimal rounds half away from zero", "/", []string{"-1", "8"}, PrecisionDecimal, 2, "-13/100", false},
+		{"Rational division", "/", []string{"1", "3"}, PrecisionRational, 0, "1/3", false},
+		{"Rational division by zero", "/", []string{"1", "0"}, PrecisionRational, 0, "", true},
+		{"Integer division rounds down", "//", []string{"-7", "2"}, PrecisionRational, 0, "-4", false},
+		{"Modulo keeps the sign of the dividend", "%", []string{"-7", "3"}, PrecisionRational, 0, "-1", false},
+		{"Negative integer power", "^", []string{"2", "-2"}, PrecisionRational, 0, "1/4", false},
+		{"Large power is exact", "^", []string{"10", "30"}, PrecisionRational, 0, "1000000000000000000000000000000", false},
+		{"Zero to a negative power", "^", []string{"0", "-1"}, PrecisionRational, 0, "", true},
+		{"Power with a huge exact result falls back to float64", "^", []string{"1180591620717411303424/1180591620717411303423", "1000"}, PrecisionRational, 0, "1", false},
+		{"Round", "round", []string{"2.345", "2"}, PrecisionRational, 0, "47/20", false},
+		{"Round digits are capped", "round", []string{"2.345", "1000000000"}, PrecisionRational, 0, "469/200", false},
+		{"Max", "max", []string{"1/3", "0.3"}, PrecisionRational, 0, "1/3", false},
+		{"Sqrt falls back to float64", "sqrt", []string{"16"}, PrecisionDecimal, 3, "4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := exactCalculator(tt.operation, tt.args, tt.precision, tt.scale)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected error, got %s", result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected: %v, got: %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestFormatExact(t *testing.T) {
+	if result := formatExact("3/10", PrecisionDecimal, 2); result != "0.30" {
+		t.Errorf("expected 0.30, got %s", result)
+	}
+
+	if result := formatExact("2/6", PrecisionRational, 0); result != "1/3" {
+		t.Errorf("expected 1/3, got %s", result)
+	}
+
+	if result := formatExact("123456789012345678901/100", PrecisionDecimal, 2); result != "1234567890123456789.01" {
+		t.Errorf("expected 1234567890123456789.01, got %s", result)
+	}
+}
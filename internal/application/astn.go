@@ -3,21 +3,87 @@ package application
 import (
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"sort"
 	"strconv"
+	"strings"
 	"unicode"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
 )
 
 type ASTNode struct {
-	IsLeaf        bool
-	Value         float64
-	Operator      string
-	Left, Right   *ASTNode
-	TaskScheduled bool
+	IsLeaf        bool       `json:"leaf,omitempty"`
+	Value         float64    `json:"value,omitempty"`
+	Exact         string     `json:"exact,omitempty"` // точное значение (запись числа или дробь a/b) для режимов decimal и rational
+	Operator      string     `json:"op,omitempty"`
+	Left          *ASTNode   `json:"left,omitempty"`
+	Right         *ASTNode   `json:"right,omitempty"`
+	Args          []*ASTNode `json:"args,omitempty"` // аргументы функции, Operator - ее имя
+	Variable      string     `json:"var,omitempty"`  // имя переменной, значение подставляет BindVariables
+	TaskScheduled bool       `json:"scheduled,omitempty"`
+	TaskID        string     `json:"task,omitempty"` // задача, которая вычисляет узел
+	Pos           int        `json:"-"`              // смещение токена узла в выражении, для ошибок проверки
 }
 
+// MaxExpressionDepth - предел вложенности выражения: скобок, аргументов функций, унарных знаков и степеней.
+// Парсер прекращает разбор, как только его превышает, поэтому рекурсия не переполняет стек
+const MaxExpressionDepth = 1000
+
+// MaxExpressionTokens - предел длины выражения. Цепочка 1+1+... не вложена, но дерево растет с ее длиной,
+// а глубже 10000 уровней json его не прочитает при загрузке из базы
+const MaxExpressionTokens = 5000
+
 type Token struct {
 	Type  TokenType
 	Value string
+	Pos   int // смещение токена в выражении, в байтах
+}
+
+// ParseError - ошибка разбора с местом, где выражение сломано
+type ParseError struct {
+	Message  string   `json:"message"`
+	Offset   int      `json:"offset"`             // смещение в байтах от начала выражения
+	Token    string   `json:"token"`              // токен, на котором остановился разбор; пустой - конец выражения
+	Expected []string `json:"expected,omitempty"` // что могло стоять на этом месте
+
+	cause error // для errors.Is: деление на ноль и т.п., по умолчанию - некорректное выражение
+}
+
+func (e *ParseError) Error() string {
+	token := e.Token
+	if token == "" {
+		token = "конец выражения"
+	}
+
+	msg := fmt.Sprintf("%s: позиция %d, токен %q", e.Message, e.Offset, token)
+	if len(e.Expected) > 0 {
+		msg += ", ожидалось: " + strings.Join(e.Expected, ", ")
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	if e.cause != nil {
+		return e.cause
+	}
+	return errorStore.IncorrectExpressionErr
+}
+
+// Наборы ожидаемых токенов для ParseError
+var (
+	expectedOperand = []string{"number", "identifier", "(", "+", "-"}
+	operators       = []string{"+", "-", "*", "/", "//", "%", "^"}
+)
+
+// expecting - операторы и еще что-то, что может стоять после операнда
+func expecting(more ...string) []string {
+	return append(append([]string{}, operators...), more...)
+}
+
+func parseError(tok Token, message string, expected ...string) *ParseError {
+	return &ParseError{Message: message, Offset: tok.Pos, Token: tok.Value, Expected: expected}
 }
 
 type TokenType int
@@ -27,12 +93,15 @@ const (
 	Operator
 	LParen
 	RParen
+	Ident
+	Comma
 	EOF
 )
 
 type Parser struct {
 	tokens []Token
 	pos    int
+	depth  int // текущая вложенность, см. MaxExpressionDepth
 }
 
 func NewNumberNode(value float64) *ASTNode {
@@ -51,28 +120,85 @@ func NewOperatorNode(operator string, left, right *ASTNode) *ASTNode {
 	}
 }
 
+func NewFunctionNode(name string, args []*ASTNode) *ASTNode {
+	return &ASTNode{
+		IsLeaf:   false,
+		Operator: name,
+		Args:     args,
+	}
+}
+
+func NewVariableNode(name string) *ASTNode {
+	return &ASTNode{
+		IsLeaf:   false,
+		Variable: name,
+	}
+}
+
+// ExactValue - точное значение узла-числа; для чисел без записи берется значение float64
+func (node *ASTNode) ExactValue() string {
+	if node.Exact != "" {
+		return node.Exact
+	}
+	return strconv.FormatFloat(node.Value, 'g', -1, 64)
+}
+
+// Children - операнды узла: аргументы функции или левый и правый операнды оператора
+func (node *ASTNode) Children() []*ASTNode {
+	if len(node.Args) > 0 {
+		return node.Args
+	}
+	return []*ASTNode{node.Left, node.Right}
+}
+
 func tokenize(expr string) ([]Token, error) {
 	var tokens []Token
 	runes := []rune(expr)
 	n := len(runes)
 	i := 0
 
+	// offsets[i] - смещение i-й руны в байтах
+	offsets := make([]int, 0, n+1)
+	for pos := range expr {
+		offsets = append(offsets, pos)
+	}
+	offsets = append(offsets, len(expr))
+
 	for i < n {
+		if len(tokens) >= MaxExpressionTokens {
+			return nil, parseError(Token{Value: string(runes[i]), Pos: offsets[i]}, fmt.Sprintf("слишком длинное выражение, допустимо %d токенов", MaxExpressionTokens))
+		}
+
 		r := runes[i]
 		switch {
 		case unicode.IsSpace(r):
 			i++
 
 		case r == '(':
-			tokens = append(tokens, Token{Type: LParen, Value: "("})
+			tokens = append(tokens, Token{Type: LParen, Value: "(", Pos: offsets[i]})
 			i++
 
 		case r == ')':
-			tokens = append(tokens, Token{Type: RParen, Value: ")"})
+			tokens = append(tokens, Token{Type: RParen, Value: ")", Pos: offsets[i]})
 			i++
 
-		case r == '+' || r == '-' || r == '*' || r == '/':
-			tokens = append(tokens, Token{Type: Operator, Value: string(r)})
+		case r == ',':
+			tokens = append(tokens, Token{Type: Comma, Value: ",", Pos: offsets[i]})
+			i++
+
+		case unicode.IsLetter(r):
+			start := i
+			for i < n && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, Token{Type: Ident, Value: string(runes[start:i]), Pos: offsets[start]})
+
+		case r == '/' && i+1 < n && runes[i+1] == '/':
+			tokens = append(tokens, Token{Type: Operator, Value: "//", Pos: offsets[i]})
+			i += 2
+
+		case r == '+' || r == '-' || r == '*' || r == '/' || r == '%' || r == '^':
+			tokens = append(tokens, Token{Type: Operator, Value: string(r), Pos: offsets[i]})
 			i++
 
 		case unicode.IsDigit(r) || r == '.':
@@ -80,13 +206,13 @@ func tokenize(expr string) ([]Token, error) {
 			for i < n && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
 				i++
 			}
-			tokens = append(tokens, Token{Type: Number, Value: string(runes[start:i])})
+			tokens = append(tokens, Token{Type: Number, Value: string(runes[start:i]), Pos: offsets[start]})
 
 		default:
-			return nil, fmt.Errorf("неизвестный символ: %c", r)
+			return nil, parseError(Token{Value: string(r), Pos: offsets[i]}, "неизвестный символ")
 		}
 	}
-	tokens = append(tokens, Token{Type: EOF})
+	tokens = append(tokens, Token{Type: EOF, Pos: len(expr)})
 	return tokens, nil
 }
 
@@ -109,6 +235,7 @@ func (p *Parser) parseExpression() (*ASTNode, error) {
 			return nil, err
 		}
 		node = NewOperatorNode(op, node, right)
+		node.Pos = tok.Pos
 	}
 	return node, nil
 }
@@ -121,7 +248,7 @@ func (p *Parser) parseTerm() (*ASTNode, error) {
 
 	for {
 		tok := p.peek()
-		if tok.Type != Operator || (tok.Value != "*" && tok.Value != "/") {
+		if tok.Type != Operator || (tok.Value != "*" && tok.Value != "/" && tok.Value != "%" && tok.Value != "//") {
 			break
 		}
 		op := tok.Value
@@ -132,6 +259,7 @@ func (p *Parser) parseTerm() (*ASTNode, error) {
 			return nil, err
 		}
 		node = NewOperatorNode(op, node, right)
+		node.Pos = tok.Pos
 	}
 	return node, nil
 }
@@ -141,6 +269,9 @@ func (p *Parser) parseFactor() (*ASTNode, error) {
 	for {
 		tok := p.peek()
 		if tok.Type == Operator && (tok.Value == "+" || tok.Value == "-") {
+			if err := p.nest(tok); err != nil {
+				return nil, err
+			}
 			ops = append(ops, tok.Value)
 			p.consume()
 		} else {
@@ -148,28 +279,69 @@ func (p *Parser) parseFactor() (*ASTNode, error) {
 		}
 	}
 
+	node, err := p.parsePower()
+	if err != nil {
+		return nil, err
+	}
+	p.depth -= len(ops)
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		node = NewOperatorNode(op, NewNumberNode(0), node)
+	}
+
+	return node, nil
+}
+
+// parsePower - степень правоассоциативна и связывает сильнее унарного минуса: -2^2 = -4, 2^3^2 = 2^9
+func (p *Parser) parsePower() (*ASTNode, error) {
+	node, err := p.parseImplicit()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Type != Operator || tok.Value != "^" {
+		return node, nil
+	}
+	p.consume()
+
+	if err = p.nest(tok); err != nil {
+		return nil, err
+	}
+	exp, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	p.depth--
+
+	node = NewOperatorNode("^", node, exp)
+	node.Pos = tok.Pos
+	return node, nil
+}
+
+// parseImplicit - неявное умножение: 2(3) = 2*3
+func (p *Parser) parseImplicit() (*ASTNode, error) {
 	node, err := p.parsePrimary()
 	if err != nil {
 		return nil, err
 	}
 
 	for p.peek().Type == LParen {
-		p.consume()
+		if err = p.nest(p.consume()); err != nil {
+			return nil, err
+		}
 		right, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
+		p.depth--
 		if next := p.consume(); next.Type != RParen {
-			return nil, errors.New("ожидалась закрывающая скобка")
+			return nil, parseError(next, "ожидалась закрывающая скобка", expecting(")")...)
 		}
 		node = NewOperatorNode("*", node, right)
 	}
 
-	for i := len(ops) - 1; i >= 0; i-- {
-		op := ops[i]
-		node = NewOperatorNode(op, NewNumberNode(0), node)
-	}
-
 	return node, nil
 }
 
@@ -179,30 +351,101 @@ func (p *Parser) parsePrimary() (*ASTNode, error) {
 	case Number:
 		val, err := strconv.ParseFloat(tok.Value, 64)
 		if err != nil {
-			return nil, fmt.Errorf("неверное число: %s", tok.Value)
+			return nil, parseError(tok, "неверное число", "number")
 		}
-		return NewNumberNode(val), nil
+		node := NewNumberNode(val)
+		node.Exact = tok.Value
+		node.Pos = tok.Pos
+		return node, nil
 
 	case LParen:
+		if err := p.nest(tok); err != nil {
+			return nil, err
+		}
 		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
+		p.depth--
 		if next := p.consume(); next.Type != RParen {
-			return nil, errors.New("ожидалась закрывающая скобка")
+			return nil, parseError(next, "ожидалась закрывающая скобка", expecting(")")...)
 		}
 		return expr, nil
 
+	case Ident:
+		if value, ok := constants[tok.Value]; ok {
+			node := NewNumberNode(value)
+			node.Pos = tok.Pos
+			return node, nil
+		}
+		if isFunction(tok.Value) {
+			return p.parseCall(tok)
+		}
+		node := NewVariableNode(tok.Value)
+		node.Pos = tok.Pos
+		return node, nil
+
+	case EOF:
+		return nil, parseError(tok, "неожиданный конец выражения", expectedOperand...)
+
 	default:
-		return nil, errors.New("неожиданный токен в выражении")
+		return nil, parseError(tok, "неожиданный токен в выражении", expectedOperand...)
+	}
+}
+
+// parseCall разбирает аргументы функции: name(a, b, ...)
+func (p *Parser) parseCall(nameTok Token) (*ASTNode, error) {
+	name := nameTok.Value
+	next := p.consume()
+	if next.Type != LParen {
+		return nil, parseError(next, "ожидалась открывающая скобка после "+name, "(")
+	}
+	if err := p.nest(next); err != nil {
+		return nil, err
+	}
+
+	var args []*ASTNode
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		next := p.consume()
+		if next.Type == RParen {
+			break
+		}
+		if next.Type != Comma {
+			return nil, parseError(next, "ожидалась запятая или закрывающая скобка", expecting(",", ")")...)
+		}
 	}
+	p.depth--
+
+	spec := functions[name]
+	if len(args) < spec.minArgs || (spec.maxArgs >= 0 && len(args) > spec.maxArgs) {
+		return nil, parseError(nameTok, fmt.Sprintf("неверное число аргументов функции %s: %d", name, len(args)))
+	}
+
+	node := NewFunctionNode(name, args)
+	node.Pos = nameTok.Pos
+	return node, nil
+}
+
+// nest - вход во вложенную конструкцию; выход - p.depth--
+func (p *Parser) nest(tok Token) error {
+	p.depth++
+	if p.depth > MaxExpressionDepth {
+		return parseError(tok, fmt.Sprintf("слишком глубокая вложенность выражения, допустимо %d уровней", MaxExpressionDepth))
+	}
+	return nil
 }
 
 func (p *Parser) peek() Token {
 	if p.pos < len(p.tokens) {
 		return p.tokens[p.pos]
 	}
-	return Token{Type: EOF}
+	return p.end()
 }
 
 func (p *Parser) consume() Token {
@@ -211,6 +454,14 @@ func (p *Parser) consume() Token {
 		p.pos++
 		return tok
 	}
+	return p.end()
+}
+
+// end - токен конца выражения (tokenize всегда добавляет его последним)
+func (p *Parser) end() Token {
+	if len(p.tokens) > 0 {
+		return p.tokens[len(p.tokens)-1]
+	}
 	return Token{Type: EOF}
 }
 
@@ -226,12 +477,112 @@ func ParseAST(expr string) (*ASTNode, error) {
 		return nil, err
 	}
 
-	if parser.peek().Type != EOF {
-		return nil, errors.New("неполный разбор выражения")
+	if tok := parser.peek(); tok.Type != EOF {
+		return nil, parseError(tok, "неполный разбор выражения", expecting("end of expression")...)
+	}
+
+	if err = ValidateAST(node); err != nil {
+		return nil, err
 	}
 	return node, nil
 }
 
+// ValidateAST проверяет разобранное выражение: запись чисел и деление на литеральный ноль.
+// Несвязанные переменные пропускаются - их значения проверяются после BindVariables
+func ValidateAST(root *ASTNode) error {
+	var walk func(node *ASTNode) error
+	walk = func(node *ASTNode) error {
+		if node == nil {
+			return nil
+		}
+
+		if node.IsLeaf {
+			if math.IsNaN(node.Value) || math.IsInf(node.Value, 0) {
+				return &ParseError{Message: "неверное число", Offset: node.Pos, Token: node.Exact, Expected: []string{"number"}}
+			}
+			if _, ok := new(big.Rat).SetString(node.ExactValue()); !ok {
+				return &ParseError{Message: "неверное число", Offset: node.Pos, Token: node.Exact, Expected: []string{"number"}}
+			}
+			return nil
+		}
+
+		if node.Variable != "" {
+			return nil
+		}
+
+		if node.Operator == "/" || node.Operator == "//" || node.Operator == "%" {
+			if right := node.Right; right != nil && right.IsLeaf && right.Value == 0 {
+				return &ParseError{Message: "деление на ноль", Offset: node.Pos, Token: node.Operator, cause: errorStore.DvsByZeroErr}
+			}
+		}
+
+		for _, child := range node.Children() {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(root)
+}
+
+// BindVariables подставляет значения переменных; если какой-то переменной нет в variables, дерево не меняется
+func BindVariables(node *ASTNode, variables map[string]float64) error {
+	names := Variables(node)
+	for _, name := range names {
+		if _, ok := variables[name]; !ok {
+			return fmt.Errorf("%w: %s", errorStore.UnboundVariableErr, name)
+		}
+	}
+
+	var bind func(node *ASTNode)
+	bind = func(node *ASTNode) {
+		if node == nil || node.IsLeaf {
+			return
+		}
+		if node.Variable != "" {
+			node.IsLeaf = true
+			node.Value = variables[node.Variable]
+			node.Exact = strconv.FormatFloat(node.Value, 'g', -1, 64)
+			return
+		}
+		for _, child := range node.Children() {
+			bind(child)
+		}
+	}
+	bind(node)
+
+	return nil
+}
+
+// Variables - имена несвязанных переменных выражения по алфавиту
+func Variables(node *ASTNode) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	var walk func(node *ASTNode)
+	walk = func(node *ASTNode) {
+		if node == nil || node.IsLeaf {
+			return
+		}
+		if node.Variable != "" {
+			if !seen[node.Variable] {
+				seen[node.Variable] = true
+				names = append(names, node.Variable)
+			}
+			return
+		}
+		for _, child := range node.Children() {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	sort.Strings(names)
+	return names
+}
+
 func Evaluate(node *ASTNode) (float64, error) {
 	if node == nil {
 		return 0, errors.New("пустой узел")
@@ -241,6 +592,22 @@ func Evaluate(node *ASTNode) (float64, error) {
 		return node.Value, nil
 	}
 
+	if node.Variable != "" {
+		return 0, fmt.Errorf("%w: %s", errorStore.UnboundVariableErr, node.Variable)
+	}
+
+	if len(node.Args) > 0 {
+		args := make([]float64, len(node.Args))
+		for i, arg := range node.Args {
+			val, err := Evaluate(arg)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = val
+		}
+		return calculateFunc(node.Operator, args)
+	}
+
 	leftVal, err := Evaluate(node.Left)
 	if err != nil {
 		return 0, err
@@ -262,6 +629,18 @@ func Evaluate(node *ASTNode) (float64, error) {
 			return 0, errors.New("деление на ноль")
 		}
 		return leftVal / rightVal, nil
+	case "%":
+		if rightVal == 0 {
+			return 0, errors.New("деление на ноль")
+		}
+		return math.Mod(leftVal, rightVal), nil
+	case "//":
+		if rightVal == 0 {
+			return 0, errors.New("деление на ноль")
+		}
+		return math.Floor(leftVal / rightVal), nil
+	case "^":
+		return math.Pow(leftVal, rightVal), nil
 	default:
 		return 0, fmt.Errorf("неизвестный оператор: %s", node.Operator)
 	}
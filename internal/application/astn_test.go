@@ -0,0 +1,189 @@
+package application
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
+)
+
+func TestParseOperators(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"2^3^2", 512},
+		{"-2^2", -4},
+		{"2^-1", 0.5},
+		{"2*3^2", 18},
+		{"(1+0.05)^2", 1.1025},
+		{"7%3", 1},
+		{"7//2", 3},
+		{"-7//2", -4},
+		{"10-7//2*2", 4},
+		{"2+10%4*3", 8},
+		{"sqrt(16)", 4},
+		{"abs(-2.5)*2", 5},
+		{"min(3, 1, 2)+max(1,2)", 3},
+		{"round(2.345, 2)", 2.35},
+		{"round(2.5)", 3},
+		{"log(e)", 1},
+		{"cos(0)+sin(0)", 1},
+		{"2*pi", 6.283185307179586},
+		{"sqrt(3^2+4^2)", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			ast, err := ParseAST(tt.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			result, err := Evaluate(ast)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected: %v, got: %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateAST(t *testing.T) {
+	// Синтаксис, который раньше по-разному понимали старый валидатор и парсер
+	for expression, expected := range map[string]float64{
+		"2(3)":      6,
+		"--2":       2,
+		"-+-2":      2,
+		"2^-1":      0.5,
+		"2*-3":      -6,
+		"(1)(2)(3)": 6,
+		"1/0.5":     2,
+	} {
+		ast, err := ParseAST(expression)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", expression, err)
+			continue
+		}
+		if result, _ := Evaluate(ast); result != expected {
+			t.Errorf("%s: expected: %v, got: %v", expression, expected, result)
+		}
+	}
+
+	for _, expression := range []string{"1/0", "1//0.0", "5%0", "2*(3/0)", "1.2.3", "1" + strings.Repeat("0", 400)} {
+		if _, err := ParseAST(expression); err == nil {
+			t.Errorf("%.20s: expected to be rejected", expression)
+		}
+	}
+
+	if _, err := ParseAST("1/0"); !errors.Is(err, errorStore.DvsByZeroErr) {
+		t.Errorf("expected division by zero, got %v", err)
+	}
+
+	// Считается вложенность, а не длина цепочки
+	nested := func(open, close string, n int) string {
+		return strings.Repeat(open, n) + "1" + strings.Repeat(close, n)
+	}
+	for _, expression := range []string{
+		nested("(", ")", MaxExpressionDepth),
+		nested("sqrt(", ")", MaxExpressionDepth),
+		nested("-", "", MaxExpressionDepth),
+		"1" + strings.Repeat("+1", MaxExpressionDepth),
+		"1" + strings.Repeat("*2", MaxExpressionTokens/2-1),
+	} {
+		if _, err := ParseAST(expression); err != nil {
+			t.Errorf("%.20s: unexpected error: %v", expression, err)
+		}
+	}
+
+	for _, expression := range []string{
+		nested("(", ")", MaxExpressionDepth+1),
+		nested("sqrt(", ")", MaxExpressionDepth+1),
+		nested("-", "", MaxExpressionDepth+1),
+		"2" + strings.Repeat("^2", MaxExpressionDepth+1),
+		"1" + strings.Repeat("+1", MaxExpressionTokens/2),
+		strings.Repeat("(", 3_000_000),
+	} {
+		if _, err := ParseAST(expression); !errors.Is(err, errorStore.IncorrectExpressionErr) {
+			t.Errorf("%.20s: expected to be rejected, got %v", expression, err)
+		}
+	}
+
+	// Нулевой делитель может появиться после подстановки переменных
+	if _, err := prepareAST("x/y", map[string]float64{"x": 1, "y": 0}); !errors.Is(err, errorStore.DvsByZeroErr) {
+		t.Errorf("expected division by zero, got %v", err)
+	}
+}
+
+func TestParseFunctionErrors(t *testing.T) {
+	for _, expression := range []string{"sqrt()", "sqrt(1,2)", "round(1,2,3)", "max(1,)", "sqrt 4"} {
+		if _, err := ParseAST(expression); err == nil {
+			t.Errorf("%s: expected parse error", expression)
+		}
+	}
+}
+
+func TestBindVariables(t *testing.T) {
+	ast, err := ParseAST("price*(1+tax)-discount*price")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = BindVariables(ast, map[string]float64{"price": 10}); !errors.Is(err, errorStore.UnboundVariableErr) {
+		t.Fatalf("expected unbound variable error, got %v", err)
+	}
+
+	if err = BindVariables(ast, map[string]float64{"price": 10, "tax": 0.5, "discount": 0.1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := Evaluate(ast); err != nil || result != 14 {
+		t.Errorf("expected: 14, got: %v, %v", result, err)
+	}
+}
+
+func TestParseErrorLocation(t *testing.T) {
+	tests := []struct {
+		expression string
+		offset     int
+		token      string
+		expected   string // один из ожидаемых токенов
+	}{
+		{"2+*3", 2, "*", "number"},
+		{"(1+2", 4, "", ")"},
+		{"1+2)", 3, ")", "end of expression"},
+		{"2 $ 3", 2, "$", ""},
+		{"sqrt(1,2)", 0, "sqrt", ""},
+		{"max(1 2)", 6, "2", ","},
+		{"ключ + $", 11, "$", ""},
+		{"", 0, "", "number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := ParseAST(tt.expression)
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected ParseError, got %v", err)
+			}
+
+			if parseErr.Offset != tt.offset || parseErr.Token != tt.token {
+				t.Errorf("expected offset %d and token %q, got %d and %q", tt.offset, tt.token, parseErr.Offset, parseErr.Token)
+			}
+
+			if tt.expected == "" {
+				return
+			}
+			for _, expected := range parseErr.Expected {
+				if expected == tt.expected {
+					return
+				}
+			}
+			t.Errorf("expected %q among %v", tt.expected, parseErr.Expected)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package application
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Identity - пользователь, от имени которого пришел запрос. Владелец выражения определяется по UserID
+type Identity struct {
+	Login  string
+	UserID int64
+	Token  string
+}
+
+type identityKey struct{}
+
+// AdminTokenHeader - заголовок, в котором /api/v1/admin/* принимает ADMIN_TOKEN
+const AdminTokenHeader = "X-Admin-Token"
+
+// publicPaths не требуют входа: на них заголовок Authorization не проверяется
+var publicPaths = map[string]bool{
+	"/":                true,
+	"/api/v1/register": true,
+	"/api/v1/login":    true,
+}
+
+func withIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func identityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Authenticate проверяет jwt из заголовка Authorization: Bearer и кладет пользователя в контекст запроса.
+// Запрос без заголовка проходит дальше: обработчики v1 тогда берут jwt из тела, как раньше
+func (o *Orchestrator) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Authorization header must be Bearer <jwt>")
+			return
+		}
+
+		id, err := parseJWT(token)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Session time is up, please, sign in again")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+	})
+}
+
+// identify возвращает пользователя из контекста, а если запрос пришел без Authorization - из jwt в теле или параметрах
+func identify(r *http.Request, token string) (Identity, error) {
+	if id, ok := identityFrom(r.Context()); ok {
+		return id, nil
+	}
+
+	id, err := parseJWT(token)
+	if err != nil {
+		return Identity{}, errors.New("Session time is up, please, sign in again")
+	}
+	return id, nil
+}
+
+// requestLogin - логин пользователя запроса, см. identify
+func requestLogin(r *http.Request, token string) (string, error) {
+	id, err := identify(r, token)
+	return id.Login, err
+}
+
+// authorizeAdmin пускает к /api/v1/admin/* только запрос с ADMIN_TOKEN в X-Admin-Token.
+// Без ADMIN_TOKEN в настройках эти методы закрыты для всех; иначе отвечает 401
+func (o *Orchestrator) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := r.Header.Get(AdminTokenHeader)
+	if o.Config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(o.Config.AdminToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode("Invalid admin token")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// maxBatchSize - сколько выражений можно передать в одном пакете
+const maxBatchSize = 1000
+
+// BatchItem - выражение пакета; поля как у /api/v1/calculate, login и jwt берутся из пакета
+type BatchItem struct {
+	Key string `json:"key,omitempty"` // ключ клиента, возвращается в ответе как есть
+	OrchReqJSON
+}
+
+type BatchReqJSON struct {
+	Expressions []BatchItem `json:"expressions"`
+	Login       string      `json:"login,omitempty"`
+	JWT         string      `json:"jwt,omitempty"`
+}
+
+// BatchResult - ID принятого выражения или ошибка проверки, в порядке запроса
+type BatchResult struct {
+	Key string `json:"key,omitempty"`
+	OrchResJSON
+}
+
+type BatchResJSON struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchHandler принимает пакет выражений за один захват o.mu; принятые выражения
+// и их задачи сохраняются в одной транзакции SQLite
+func (o *Orchestrator) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var request BatchReqJSON
+	defer r.Body.Close()
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&request); err != nil {
+		http.Error(w, `{"error":"Invalid Body"}`, http.StatusBadRequest)
+		return
+	}
+
+	owner, ok := o.authorize(w, r, request.Login, request.JWT)
+	if !ok {
+		return
+	}
+	request.Login, request.JWT = owner.Login, owner.Token
+
+	if len(request.Expressions) == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(OrchResJSON{Error: "Empty batch"})
+		return
+	}
+	if len(request.Expressions) > maxBatchSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(OrchResJSON{Error: fmt.Sprintf("Batch is limited to %d expressions", maxBatchSize)})
+		return
+	}
+
+	results := make([]BatchResult, len(request.Expressions))
+	accepted := make([]*Expression, 0, len(request.Expressions))
+	for i, item := range request.Expressions {
+		item.Login, item.JWT = request.Login, request.JWT
+		results[i].Key = item.Key
+
+		expr, err := o.newExpression(&item.OrchReqJSON, owner.UserID)
+		if err != nil {
+			results[i].OrchResJSON = exprErrorResp(err)
+			continue
+		}
+		accepted = append(accepted, expr)
+	}
+
+	if err := o.submitAll(accepted); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+		log.Println(err)
+		return
+	}
+
+	next := 0
+	for i := range results {
+		if results[i].Error == "" {
+			results[i].ID = accepted[next].ID
+			next++
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BatchResJSON{Results: results})
+}
+
+// submitAll ставит выражения в очередь и сохраняет их в одной транзакции: при ошибке
+// не сохраняется ни одно и все они убираются из памяти. Вызывать под o.mu
+func (o *Orchestrator) submitAll(exprs []*Expression) error {
+	if len(exprs) == 0 {
+		return nil
+	}
+
+	tx, err := o.Db.BeginTx(o.Ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	o.tx = tx
+	for _, expr := range exprs {
+		if err = o.submit(expr); err != nil {
+			break
+		}
+	}
+	o.tx = nil
+
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+
+	effects := o.afterTx
+	o.afterTx = nil
+	if err == nil {
+		for _, fn := range effects {
+			fn()
+		}
+	}
+
+	if err != nil {
+		for _, expr := range exprs {
+			if expr.ID == "" {
+				continue
+			}
+			delete(o.ExprStore, expr.ID)
+			o.queue.remove(func(task *Task) bool { return task.ExprID == expr.ID })
+			for id, task := range o.taskStore {
+				if task.ExprID == expr.ID {
+					delete(o.taskStore, id)
+				}
+			}
+		}
+		return err
+	}
+
+	return nil
+}
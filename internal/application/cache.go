@@ -0,0 +1,227 @@
+package application
+
+import (
+	"container/list"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cacheEntry struct {
+	key     string
+	value   float64
+	exact   string
+	expires time.Time
+}
+
+// ResultCache - LRU-кэш результатов задач, общий для всех пользователей. Вызывать под o.mu
+type ResultCache struct {
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // в начале - последние использованные
+	hits    int
+	misses  int
+}
+
+type CacheStats struct {
+	Size     int  `json:"size"`
+	Capacity int  `json:"capacity"`
+	TTL      int  `json:"ttl_ms"`
+	Hits     int  `json:"hits"`
+	Misses   int  `json:"misses"`
+	Persist  bool `json:"persist"`
+}
+
+func newResultCache(size int, ttl time.Duration) *ResultCache {
+	return &ResultCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get возвращает результат по ключу; просроченная запись удаляется и ее ключ возвращается в expired
+func (c *ResultCache) get(key string, now time.Time) (entry *cacheEntry, expired string, ok bool) {
+	if c.size <= 0 {
+		return nil, "", false
+	}
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, "", false
+	}
+
+	entry = el.Value.(*cacheEntry)
+	if now.After(entry.expires) {
+		c.remove(el)
+		c.misses++
+		return nil, key, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits++
+	return entry, "", true
+}
+
+// put добавляет запись и возвращает ключи вытесненных записей
+func (c *ResultCache) put(entry *cacheEntry) []string {
+	if c.size <= 0 {
+		return nil
+	}
+
+	if el, ok := c.entries[entry.key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+
+	var evicted []string
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		evicted = append(evicted, el.Value.(*cacheEntry).key)
+		c.remove(el)
+	}
+	return evicted
+}
+
+func (c *ResultCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*cacheEntry).key)
+	c.order.Remove(el)
+}
+
+// cacheKey - каноническая запись задачи: операция, режим точности и значения аргументов
+func (t *Task) cacheKey() string {
+	precision, args := PrecisionFloat64, make([]string, 0, 2)
+	if isExact(t.Precision) {
+		precision = t.Precision + ":" + strconv.Itoa(t.Scale)
+		for _, arg := range t.ExactArgs {
+			// 0.5 и 1/2 - один и тот же аргумент
+			if r, ok := new(big.Rat).SetString(arg); ok {
+				arg = r.RatString()
+			}
+			args = append(args, arg)
+		}
+	} else {
+		values := t.Args
+		if len(values) == 0 {
+			values = []float64{t.Arg1, t.Arg2}
+		}
+		for _, value := range values {
+			args = append(args, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	}
+
+	return t.Operation + "|" + precision + "|" + strings.Join(args, ",")
+}
+
+// cached ищет результат задачи в кэше. Вызывать под o.mu
+func (o *Orchestrator) cached(task *Task) (*cacheEntry, bool) {
+	entry, expired, ok := o.cache.get(task.cacheKey(), time.Now())
+	if expired != "" {
+		o.uncache(expired)
+	}
+	return entry, ok
+}
+
+// cacheResult запоминает результат выполненной задачи. Вызывать под o.mu
+func (o *Orchestrator) cacheResult(task *Task, value float64, exact string) {
+	entry := &cacheEntry{key: task.cacheKey(), value: value, exact: exact, expires: time.Now().Add(o.cache.ttl)}
+	for _, key := range o.cache.put(entry) {
+		o.uncache(key)
+	}
+
+	if !o.Config.CachePersist || o.cache.size <= 0 {
+		return
+	}
+	q := `INSERT OR REPLACE INTO results_cache(key, value, exact, expires_at) VALUES(?, ?, ?, ?)`
+	if _, err := o.store().ExecContext(o.Ctx, q, entry.key, entry.value, entry.exact, entry.expires.UnixMilli()); err != nil {
+		log.Printf("Saving cached result error: %v", err)
+	}
+}
+
+func (o *Orchestrator) uncache(key string) {
+	if !o.Config.CachePersist {
+		return
+	}
+	if _, err := o.store().ExecContext(o.Ctx, `DELETE FROM results_cache WHERE key = ?`, key); err != nil {
+		log.Printf("Deleting cached result error: %v", err)
+	}
+}
+
+// LoadCache поднимает сохраненный кэш результатов (CACHE_PERSIST=true)
+func (o *Orchestrator) LoadCache() error {
+	if !o.Config.CachePersist {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	if _, err := o.Db.ExecContext(o.Ctx, `DELETE FROM results_cache WHERE expires_at <= ?`, now.UnixMilli()); err != nil {
+		return err
+	}
+
+	// Самые старые - первыми, чтобы свежие оказались в начале LRU
+	rows, err := o.Db.QueryContext(o.Ctx, `SELECT key, value, exact, expires_at FROM results_cache ORDER BY expires_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var evicted []string
+	for rows.Next() {
+		var (
+			entry   = &cacheEntry{}
+			expires int64
+		)
+		if err = rows.Scan(&entry.key, &entry.value, &entry.exact, &expires); err != nil {
+			return err
+		}
+		entry.expires = time.UnixMilli(expires)
+		evicted = append(evicted, o.cache.put(entry)...)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range evicted {
+		o.uncache(key)
+	}
+	return nil
+}
+
+// CacheOutput - размер кэша результатов и счетчики попаданий
+func (o *Orchestrator) CacheOutput(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !o.authorizeAdmin(w, r) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CacheStats{
+		Size:     o.cache.order.Len(),
+		Capacity: o.cache.size,
+		TTL:      int(o.cache.ttl / time.Millisecond),
+		Hits:     o.cache.hits,
+		Misses:   o.cache.misses,
+		Persist:  o.Config.CachePersist,
+	})
+}
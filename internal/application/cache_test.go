@@ -0,0 +1,77 @@
+package application
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultCache(t *testing.T) {
+	now := time.Now()
+	cache := newResultCache(2, time.Minute)
+
+	put := func(key string, value float64) []string {
+		return cache.put(&cacheEntry{key: key, value: value, expires: now.Add(time.Minute)})
+	}
+
+	put("a", 1)
+	put("b", 2)
+	if _, _, ok := cache.get("a", now); !ok {
+		t.Fatal("Expected a hit for a")
+	}
+
+	// b используется реже всех - его и вытесняем
+	if evicted := put("c", 3); len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("Expected b to be evicted, but got %v", evicted)
+	}
+	if _, _, ok := cache.get("b", now); ok {
+		t.Fatal("Expected a miss for b")
+	}
+
+	if _, expired, ok := cache.get("c", now.Add(2*time.Minute)); ok || expired != "c" {
+		t.Fatalf("Expected c to expire, but got %v %q", ok, expired)
+	}
+
+	if cache.hits != 1 || cache.misses != 2 || cache.order.Len() != 1 {
+		t.Fatalf("Unexpected stats: hits %d, misses %d, size %d", cache.hits, cache.misses, cache.order.Len())
+	}
+
+	disabled := newResultCache(0, time.Minute)
+	disabled.put(&cacheEntry{key: "a", expires: now.Add(time.Minute)})
+	if _, _, ok := disabled.get("a", now); ok || disabled.misses != 0 {
+		t.Fatal("Expected disabled cache to store nothing")
+	}
+}
+
+func TestTaskCacheKey(t *testing.T) {
+	tests := []struct {
+		a, b  *Task
+		equal bool
+	}{
+		{&Task{Operation: "+", Arg1: 1, Arg2: 2}, &Task{Operation: "+", Arg1: 1, Arg2: 2}, true},
+		{&Task{Operation: "+", Arg1: 1, Arg2: 2}, &Task{Operation: "+", Arg1: 2, Arg2: 1}, false},
+		{&Task{Operation: "+", Arg1: 1, Arg2: 2}, &Task{Operation: "-", Arg1: 1, Arg2: 2}, false},
+		{&Task{Operation: "max", Args: []float64{1, 2}}, &Task{Operation: "max", Arg1: 1, Arg2: 2}, true},
+		{&Task{Operation: "+", Arg1: 0.5, Arg2: 1}, &Task{Operation: "+", Arg1: 0.5, Arg2: 1, Precision: PrecisionFloat64}, true},
+		{
+			&Task{Operation: "+", Precision: PrecisionRational, ExactArgs: []string{"0.5", "1"}},
+			&Task{Operation: "+", Precision: PrecisionRational, ExactArgs: []string{"1/2", "1.0"}},
+			true,
+		},
+		{
+			&Task{Operation: "/", Precision: PrecisionDecimal, Scale: 2, ExactArgs: []string{"1", "3"}},
+			&Task{Operation: "/", Precision: PrecisionDecimal, Scale: 3, ExactArgs: []string{"1", "3"}},
+			false,
+		},
+		{
+			&Task{Operation: "+", Arg1: 0.5, Arg2: 1},
+			&Task{Operation: "+", Precision: PrecisionRational, ExactArgs: []string{"1/2", "1"}},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		if equal := tt.a.cacheKey() == tt.b.cacheKey(); equal != tt.equal {
+			t.Errorf("Case %d: expected equal keys %v, but got %q and %q", i, tt.equal, tt.a.cacheKey(), tt.b.cacheKey())
+		}
+	}
+}
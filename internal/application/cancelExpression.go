@@ -0,0 +1,53 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+// CancelExpression останавливает вычисление выражения; отменить можно только свое выражение
+func (o *Orchestrator) CancelExpression(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var wt JWTforExpr
+	if err := json.NewDecoder(r.Body).Decode(&wt); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"Invalid Body"}`, http.StatusBadRequest)
+		return
+	}
+
+	id, ok := o.authorize(w, r, "", wt.JWT)
+	if !ok {
+		return
+	}
+
+	expr, ok := o.ExprStore[r.PathValue("id")]
+	if !ok || !expr.ownedBy(id) {
+		http.Error(w, `{"error":"Expression not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if isFinal(expr.Status) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(OrchResJSON{ID: expr.ID, Error: "Expression is already " + expr.Status})
+		return
+	}
+
+	o.setStatus(expr, "cancelled")
+	o.dropTasks(expr.ID, true)
+
+	if err := o.AddExpr(expr, true, o.Db); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ExprResp{Expression: expr})
+}
@@ -0,0 +1,49 @@
+package application
+
+import (
+	"errors"
+	"time"
+)
+
+// setDeadline проверяет срок из запроса: он должен быть в будущем
+func setDeadline(expr *Expression, deadline *time.Time, now time.Time) error {
+	if deadline == nil || deadline.IsZero() {
+		return nil
+	}
+	if !deadline.After(now) {
+		return errors.New("deadline is in the past")
+	}
+
+	expr.Deadline = deadline
+	return nil
+}
+
+// missed - срок выражения прошел
+func (expr *Expression) missed(now time.Time) bool {
+	return expr.Deadline != nil && now.After(*expr.Deadline)
+}
+
+// timeoutExpr завершает выражение, не успевшее к сроку, и снимает его задачи. Вызывать под o.mu
+func (o *Orchestrator) timeoutExpr(expr *Expression) {
+	expr.Reason = "deadline exceeded"
+	o.setStatus(expr, "timed_out")
+	// Задачи у агентов остаются до ответа, как при отмене - опоздавший результат просто отбросится
+	o.dropTasks(expr.ID, true)
+	// Ошибку базы saveFinal только логирует, статус timed_out допишет RetryUnsaved на следующем проходе
+	o.saveFinal(expr)
+}
+
+// TimeoutExpired помечает timed_out выражения, срок которых прошел к моменту now
+func (o *Orchestrator) TimeoutExpired(now time.Time) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, expr := range o.ExprStore {
+		if !isFinal(expr.Status) && expr.missed(now) {
+			o.timeoutExpr(expr)
+			n++
+		}
+	}
+	return n
+}
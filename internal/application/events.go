@@ -0,0 +1,226 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Типы событий выражения
+const (
+	EventStatus = "status" // выражение сменило статус
+	EventNode   = "node"   // агент посчитал узел дерева
+)
+
+// eventBuffer - сколько событий может ждать отправки одному подписчику; кто отстал сильнее, отключается
+const eventBuffer = 64
+
+// sseKeepAlive - как часто в пустой поток SSE пишется комментарий, чтобы прокси не закрыли соединение
+const sseKeepAlive = 15 * time.Second
+
+type Event struct {
+	Seq       int64  `json:"seq"`
+	Type      string `json:"type"`
+	ExprID    string `json:"id"`
+	Status    string `json:"status,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	TaskID    string `json:"task_id,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Value     string `json:"value,omitempty"`
+
+	userID int64
+}
+
+// subscriber получает события выражений пользователя userID; если exprID не пустой - только этого выражения
+type subscriber struct {
+	userID int64
+	exprID string
+	ch     chan Event
+}
+
+// eventHub рассылает события подписчикам. У него свой мьютекс: потоки читают события без o.mu
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+	seq  int64
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[*subscriber]struct{})}
+}
+
+func (h *eventHub) subscribe(userID int64, exprID string) *subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &subscriber{userID: userID, exprID: exprID, ch: make(chan Event, eventBuffer)}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// publish отправляет событие подписчикам; переполненный канал закрывается, клиент переподключится
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	event.Seq = h.seq
+
+	for sub := range h.subs {
+		if sub.userID != event.userID || (sub.exprID != "" && sub.exprID != event.ExprID) {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+func statusEvent(expr *Expression) Event {
+	return Event{Type: EventStatus, ExprID: expr.ID, Status: expr.Status, Result: expr.Result, Reason: expr.Reason, userID: expr.UserID}
+}
+
+// setStatus меняет статус выражения и сообщает об этом подписчикам и вебхуку. Вызывать под o.mu
+func (o *Orchestrator) setStatus(expr *Expression, status string) {
+	if expr.Status == status {
+		return
+	}
+	expr.Status = status
+
+	event := statusEvent(expr)
+	o.afterCommit(func() {
+		o.events.publish(event)
+		if status == "completed" || status == "failed" {
+			o.notifyWebhook(expr)
+		}
+	})
+}
+
+// afterCommit выполняет fn сразу, а пока сохраняется пакет - после его Commit: клиенты не должны
+// узнать о выражениях, которых после отката не будет. Вызывать под o.mu
+func (o *Orchestrator) afterCommit(fn func()) {
+	if o.tx != nil {
+		o.afterTx = append(o.afterTx, fn)
+		return
+	}
+	fn()
+}
+
+// publishNode сообщает подписчикам результат узла, который прислал агент. Вызывать под o.mu
+func (o *Orchestrator) publishNode(expr *Expression, task *Task) {
+	value := strconv.FormatFloat(task.Node.Value, 'g', -1, 64)
+	if isExact(expr.Precision) {
+		value = formatExact(task.Node.ExactValue(), expr.Precision, expr.Scale)
+	}
+
+	o.events.publish(Event{Type: EventNode, ExprID: expr.ID, TaskID: task.ID, Operation: task.Operation, Value: value, userID: expr.UserID})
+}
+
+// ExpressionEvents - поток SSE с событиями одного выражения; закрывается, когда выражение завершилось.
+// EventSource не умеет передавать заголовки, поэтому jwt можно передать и в параметре ?jwt=
+func (o *Orchestrator) ExpressionEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := identify(r, r.URL.Query().Get("jwt"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode("Session time is up, please, sign in again")
+		return
+	}
+
+	// Подписываемся под o.mu: между снимком статуса и подпиской событие не потеряется
+	o.mu.Lock()
+	expr, ok := o.ExprStore[r.PathValue("id")]
+	if !ok || !expr.ownedBy(id) {
+		o.mu.Unlock()
+		http.Error(w, `{"error":"Expression not found"}`, http.StatusNotFound)
+		return
+	}
+	sub := o.events.subscribe(id.UserID, expr.ID)
+	snapshot := statusEvent(expr)
+	o.mu.Unlock()
+
+	defer o.events.unsubscribe(sub)
+	streamEvents(w, r, sub, &snapshot, true)
+}
+
+// UserEvents - поток SSE со всеми событиями выражений пользователя
+func (o *Orchestrator) UserEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := identify(r, r.URL.Query().Get("jwt"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode("Session time is up, please, sign in again")
+		return
+	}
+
+	sub := o.events.subscribe(id.UserID, "")
+	defer o.events.unsubscribe(sub)
+	streamEvents(w, r, sub, nil, false)
+}
+
+// streamEvents пишет события в формате SSE, пока клиент не отключится; при untilFinal - до завершения выражения
+func streamEvents(w http.ResponseWriter, r *http.Request, sub *subscriber, snapshot *Event, untilFinal bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"Streaming is not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if snapshot != nil {
+		writeEvent(w, *snapshot)
+	}
+	flusher.Flush()
+	if snapshot != nil && untilFinal && isFinal(snapshot.Status) {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+			if untilFinal && event.Type == EventStatus && isFinal(event.Status) {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+}
@@ -2,10 +2,7 @@ package application
 
 import (
 	"encoding/json"
-	"math"
 	"net/http"
-	"strconv"
-	"sync"
 )
 
 type ExprResp struct {
@@ -17,20 +14,16 @@ type IDForExpression struct {
 	JWT string `json:"jwt,omitempty"`
 }
 
-var (
-	mu sync.Mutex
-)
-
 func (o *Orchestrator) ExpressionByID(w http.ResponseWriter, r *http.Request) {
-	mu.Lock()
-	defer mu.Unlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
 	w.Header().Set("Content-Type", "application/json")
 
 	request := new(IDForExpression)
 	json.NewDecoder(r.Body).Decode(&request)
 
-	err := strimJWT("User", request.JWT)
+	id, err := identify(r, request.JWT)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode("Session time is up, please, sign in again")
@@ -39,16 +32,11 @@ func (o *Orchestrator) ExpressionByID(w http.ResponseWriter, r *http.Request) {
 
 	expr, ok := o.ExprStore[request.ID]
 
-	if !ok || request.JWT != expr.Jwt {
+	if !ok || !expr.ownedBy(id) {
 		http.Error(w, `{"error":"Expression not found"}`, http.StatusNotFound)
 		return
 	}
 
-	if expr.AST != nil && expr.AST.IsLeaf {
-		expr.Status = "completed"
-		expr.Result = strconv.FormatFloat(math.Round(expr.AST.Value*100)/100, 'g', 8, 32)
-	}
-
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(ExprResp{Expression: expr})
 }
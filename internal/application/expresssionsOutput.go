@@ -2,10 +2,9 @@ package application
 
 import (
 	"encoding/json"
-	"math"
+	"errors"
+	"io"
 	"net/http"
-	"strconv"
-	"sync"
 )
 
 type SlExprsResp struct {
@@ -21,22 +20,20 @@ var EmptyExpression = &Expression{
 }
 
 func (o *Orchestrator) ExpressionsOutput(w http.ResponseWriter, r *http.Request) { //Сервер, который выводит все переданные серверу выражения
-	var (
-		mu sync.Mutex
-		wt JWTforExpr
-	)
+	var wt JWTforExpr
 
-	mu.Lock()
-	defer mu.Unlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if err := json.NewDecoder(r.Body).Decode(&wt); err != nil {
+	// С заголовком Authorization тело не нужно
+	if err := json.NewDecoder(r.Body).Decode(&wt); err != nil && !errors.Is(err, io.EOF) {
 		http.Error(w, "Decoding jwt error", http.StatusConflict)
 		return
 	}
 
-	err := strimJWT("User", wt.JWT)
+	id, err := identify(r, wt.JWT)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode("Session time is up, please, sign in again")
@@ -46,14 +43,9 @@ func (o *Orchestrator) ExpressionsOutput(w http.ResponseWriter, r *http.Request)
 	exprs := make([]*Expression, 0, len(o.ExprStore))
 
 	for _, expr := range o.ExprStore {
-		if expr.Jwt != wt.JWT {
+		if !expr.ownedBy(id) {
 			continue
 		}
-
-		if expr.AST != nil && expr.AST.IsLeaf {
-			expr.Status = "completed"
-			expr.Result = strconv.FormatFloat(math.Round(expr.AST.Value*100)/100, 'g', 8, 32)
-		}
 		exprs = append(exprs, expr)
 	}
 
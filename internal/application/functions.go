@@ -0,0 +1,103 @@
+package application
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
+)
+
+// arity - сколько аргументов принимает функция; maxArgs < 0 - сколько угодно
+type arity struct {
+	minArgs, maxArgs int
+}
+
+var functions = map[string]arity{
+	"sqrt":  {1, 1},
+	"abs":   {1, 1},
+	"min":   {1, -1},
+	"max":   {1, -1},
+	"round": {1, 2},
+	"log":   {1, 1},
+	"sin":   {1, 1},
+	"cos":   {1, 1},
+	"tan":   {1, 1},
+}
+
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+func isFunction(name string) bool {
+	_, ok := functions[name]
+	return ok
+}
+
+// functionTimesFromEnv - время выполнения функций: TIME_SQRT_MS, TIME_MIN_MS и т.д.
+func functionTimesFromEnv() map[string]int {
+	times := make(map[string]int, len(functions))
+	for name := range functions {
+		t, _ := strconv.Atoi(os.Getenv("TIME_" + strings.ToUpper(name) + "_MS"))
+		if t == 0 {
+			t = 1000
+		}
+		times[name] = t
+	}
+	return times
+}
+
+// calculateFunc считает встроенную функцию; round(x, n) округляет до n знаков после запятой
+func calculateFunc(name string, args []float64) (float64, error) {
+	spec, ok := functions[name]
+	if !ok || len(args) < spec.minArgs || (spec.maxArgs >= 0 && len(args) > spec.maxArgs) {
+		return 0, errorStore.UnknownOperatorErr
+	}
+
+	var result float64
+	switch name {
+	case "sqrt":
+		result = math.Sqrt(args[0])
+	case "abs":
+		result = math.Abs(args[0])
+	case "min":
+		result = args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+	case "max":
+		result = args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+	case "round":
+		if len(args) == 1 {
+			result = math.Round(args[0])
+			break
+		}
+		// Дальше 10^308 float64 не дотягивается
+		scale := math.Pow(10, float64(roundDigits(args[1], 308)))
+		if shifted := args[0] * scale; math.IsInf(shifted, 0) {
+			result = args[0] // знаков после запятой меньше, чем n
+		} else {
+			result = math.Round(shifted) / scale
+		}
+	case "log":
+		result = math.Log(args[0])
+	case "sin":
+		result = math.Sin(args[0])
+	case "cos":
+		result = math.Cos(args[0])
+	case "tan":
+		result = math.Tan(args[0])
+	}
+
+	// sqrt(-1), log(0) и т.п.
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, errorStore.OutOfDomainErr
+	}
+
+	return result, nil
+}
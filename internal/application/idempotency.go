@@ -0,0 +1,80 @@
+package application
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
+)
+
+// IdempotencyHeader - заголовок, по которому повтор запроса возвращает уже созданное выражение
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey - максимальная длина ключа
+const maxIdempotencyKey = 255
+
+// requestFingerprint - отпечаток запроса без jwt: после повторного входа токен другой, а запрос тот же
+func requestFingerprint(request *OrchReqJSON) string {
+	r := *request
+	r.JWT = ""
+	body, _ := json.Marshal(r)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotent возвращает ID выражения, созданного пользователем с этим ключом не раньше IdempotencyTTL назад.
+// Тот же ключ с другим запросом - IdempotencyKeyErr. Вызывать под o.mu
+func (o *Orchestrator) idempotent(login, key, fingerprint string, now time.Time) (string, bool, error) {
+	var (
+		exprID    int
+		stored    string
+		createdAt int64
+	)
+
+	q := `SELECT expr_id, fingerprint, created_at FROM idempotency_keys WHERE user_lg = ? AND key = ?`
+	err := o.Db.QueryRowContext(o.Ctx, q, login, key).Scan(&exprID, &stored, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if o.keyExpired(createdAt, now) {
+		return "", false, nil
+	}
+	if stored != fingerprint {
+		return "", false, errorStore.IdempotencyKeyErr
+	}
+
+	return strconv.Itoa(exprID), true, nil
+}
+
+// rememberKey запоминает, какое выражение создано по ключу; старая запись с тем же ключом заменяется
+func (o *Orchestrator) rememberKey(login, key, fingerprint, exprID string, now time.Time) error {
+	q := `INSERT OR REPLACE INTO idempotency_keys(user_lg, key, fingerprint, expr_id, created_at) VALUES(?, ?, ?, ?, ?)`
+	_, err := o.store().ExecContext(o.Ctx, q, login, key, fingerprint, exprID, now.UnixMilli())
+	return err
+}
+
+func (o *Orchestrator) keyExpired(createdAt int64, now time.Time) bool {
+	return now.Sub(time.UnixMilli(createdAt)) > time.Duration(o.Config.IdempotencyTTL)*time.Millisecond
+}
+
+// PurgeIdempotencyKeys удаляет ключи старше IdempotencyTTL
+func (o *Orchestrator) PurgeIdempotencyKeys(now time.Time) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	before := now.Add(-time.Duration(o.Config.IdempotencyTTL) * time.Millisecond).UnixMilli()
+	res, err := o.Db.ExecContext(o.Ctx, `DELETE FROM idempotency_keys WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
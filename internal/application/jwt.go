@@ -1,18 +1,20 @@
 package application
 
 import (
-	"time"
 	"fmt"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 const hmacSampleSecret = "really_secret_signature"
 
-func AddJWT(u string) string {
-	now := time.Now() 
+// AddJWT выдает токен пользователю: name - логин, uid - ID из таблицы users, по нему проверяется владелец выражения
+func AddJWT(u string, userID int64) string {
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"name": u,
+		"uid":  userID,
 		"nbf":  now.Unix(),
 		"exp":  now.Add(5 * time.Minute).Unix(),
 		"iat":  now.Unix(),
@@ -26,23 +28,34 @@ func AddJWT(u string) string {
 	return tokenString
 }
 
-func strimJWT(u, t string) error {
+// parseJWT проверяет подпись и срок токена и достает из него пользователя
+func parseJWT(t string) (Identity, error) {
 	tokenFromString, err := jwt.Parse(t, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
 		return []byte(hmacSampleSecret), nil
 	})
-
 	if err != nil {
-		return err
+		return Identity{}, err
+	}
+
+	claims, ok := tokenFromString.Claims.(jwt.MapClaims)
+	if !ok {
+		return Identity{}, fmt.Errorf("unexpected claims")
+	}
+
+	login, ok := claims["name"].(string)
+	if !ok || login == "" {
+		return Identity{}, fmt.Errorf("token without login")
 	}
 
-	if claims, ok := tokenFromString.Claims.(jwt.MapClaims); ok {
-		fmt.Println(u, claims["name"])
+	// Числа в JSON разбираются во float64
+	uid, ok := claims["uid"].(float64)
+	if !ok || uid <= 0 {
+		return Identity{}, fmt.Errorf("token without user id")
 	}
 
-	return err
-	
-}
\ No newline at end of file
+	return Identity{Login: login, UserID: int64(uid), Token: t}, nil
+}
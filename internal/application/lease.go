@@ -0,0 +1,125 @@
+package application
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// agentIDKey - ключ gRPC-метаданных, в котором агент передает свой ID
+const agentIDKey = "agent-id"
+
+// agentInstanceKey - ключ метаданных со случайным ID процесса агента: по нему два агента с одним ID различаются
+const agentInstanceKey = "agent-instance"
+
+// taskOwner - кто забирает задачу: ID агента из метаданных, для старых агентов - адрес соединения
+func taskOwner(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if id := md.Get(agentIDKey); len(id) > 0 && id[0] != "" {
+			return id[0]
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// agentInstance - ID процесса агента из метаданных, у старых агентов пустой
+func agentInstance(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if instance := md.Get(agentInstanceKey); len(instance) > 0 {
+			return instance[0]
+		}
+	}
+	return ""
+}
+
+// lease выдает задачу агенту до истечения Operation_time + LeaseSlack. Вызывать под o.mu
+func (o *Orchestrator) lease(task *Task, owner string) {
+	o.leaseCounter++
+	task.Owner = owner
+	task.LeaseID = task.ID + "-" + strconv.Itoa(o.leaseCounter)
+	task.Deadline = time.Now().Add(time.Duration(task.Operation_time+o.Config.LeaseSlack) * time.Millisecond)
+}
+
+// checkLease проверяет, что результат прислал текущий держатель задачи. Вызывать под o.mu
+func (o *Orchestrator) checkLease(task *Task, leaseID, owner string) error {
+	if task.LeaseID == "" {
+		return errorStore.LeaseExpiredErr
+	}
+
+	if time.Now().After(task.Deadline) {
+		o.requeue([]*Task{task})
+		return errorStore.LeaseExpiredErr
+	}
+
+	// Старые агенты не знают про lease_id - сверяем хотя бы адрес
+	if leaseID == "" && task.Owner != owner {
+		return errorStore.LeaseMismatchErr
+	}
+
+	if leaseID != "" && leaseID != task.LeaseID {
+		return errorStore.LeaseMismatchErr
+	}
+
+	return nil
+}
+
+// requeue снимает аренду и возвращает задачи в начало очереди. Вызывать под o.mu
+func (o *Orchestrator) requeue(tasks []*Task) {
+	for _, task := range tasks {
+		task.Owner = ""
+		task.LeaseID = ""
+		task.Deadline = time.Time{}
+	}
+	o.queue.pushFront(tasks)
+	if len(tasks) > 0 {
+		o.notify()
+	}
+}
+
+// releaseOwner возвращает в очередь все задачи, которые держит агент owner
+func (o *Orchestrator) releaseOwner(owner string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.requeueWhere(func(task *Task) bool {
+		return task.LeaseID != "" && task.Owner == owner
+	})
+}
+
+// RequeueExpired возвращает в очередь задачи, аренда которых истекла к моменту now
+func (o *Orchestrator) RequeueExpired(now time.Time) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.requeueWhere(func(task *Task) bool {
+		return task.LeaseID != "" && now.After(task.Deadline)
+	})
+}
+
+// requeueWhere возвращает в очередь арендованные задачи, подходящие под условие. Вызывать под o.mu
+func (o *Orchestrator) requeueWhere(match func(task *Task) bool) int {
+	tasks := make([]*Task, 0)
+	for _, task := range o.taskStore {
+		if match(task) {
+			tasks = append(tasks, task)
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		a, _ := strconv.Atoi(tasks[i].ID)
+		b, _ := strconv.Atoi(tasks[j].ID)
+		return a < b
+	})
+
+	o.requeue(tasks)
+	return len(tasks)
+}
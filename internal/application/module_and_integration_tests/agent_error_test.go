@@ -0,0 +1,146 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestAgentReportedError(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", "teststore.db")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	ap.CreateTables()
+
+	ast, err := application.ParseAST("1/(2-2)+(3+4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{
+		ID:     "1",
+		Expr:   "1/(2-2)+(3+4)",
+		Login:  "User",
+		Status: "pending",
+		AST:    ast,
+	}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+
+	//// 2-2
+	rs, err := ap.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ap.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: 0, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	//// 3+4 is still in the queue, 1/0 goes after it
+	for rs.Operation != "/" {
+		if rs, err = ap.Get(ctx, &pb.Empty{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = ap.Post(ctx, &pb.PostRequest{
+		Id:      rs.Id,
+		LeaseId: rs.LeaseId,
+		Error:   &pb.TaskError{Code: application.ErrCodeDivisionByZero, Message: "division by zero"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expr.Status != "failed" || expr.Reason != "division by zero" {
+		t.Fatalf("Expected failed expression with reason, but got %s %q", expr.Status, expr.Reason)
+	}
+
+	if _, err = ap.Get(ctx, &pb.Empty{}); err == nil {
+		t.Fatal("Tasks of a failed expression must be dropped")
+	}
+}
+
+func TestAgentErrorSaveRetry(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agent_error.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	if err = ap.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	ast, err := application.ParseAST("1/(2-2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{ID: "1", Expr: "1/(2-2)", Login: "User", Status: "pending", AST: ast}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+	if err = ap.AddExpr(expr, false, db); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ap.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ap.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: 0, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+	if rs, err = ap.Get(ctx, &pb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+
+	//// The database fails while the error is recorded: the orchestrator keeps running with the failed expression in memory
+	if _, err = db.Exec(`ALTER TABLE expressions RENAME TO expressions_off`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ap.Post(ctx, &pb.PostRequest{
+		Id:      rs.Id,
+		LeaseId: rs.LeaseId,
+		Error:   &pb.TaskError{Code: application.ErrCodeDivisionByZero, Message: "division by zero"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved, _ := ap.Lookup(expr.ID); saved.Status != "failed" {
+		t.Fatalf("Expected failed expression, but got %s", saved.Status)
+	}
+	if n := ap.RetryUnsaved(); n != 1 {
+		t.Fatalf("Expected 1 unsaved expression while the database fails, but got %d", n)
+	}
+
+	//// The next pass saves it
+	if _, err = db.Exec(`ALTER TABLE expressions_off RENAME TO expressions`); err != nil {
+		t.Fatal(err)
+	}
+	if n := ap.RetryUnsaved(); n != 0 {
+		t.Fatalf("Expected all expressions saved, but got %d unsaved", n)
+	}
+
+	var status string
+	if err = db.QueryRow(`SELECT status FROM expressions WHERE id = 1`).Scan(&status); err != nil || status != "failed" {
+		t.Fatalf("Expected the failed status in the database, but got %q %v", status, err)
+	}
+}
@@ -91,15 +91,18 @@ func TestIntegratAgent(t *testing.T) {
 				}
 				log.Printf("Task ID: %s, err: %s", id, err)
 			}
-
-			time.Sleep(2 * time.Second)
-
-			if expr = ap.ExprStore[exprID]; expr.Status != "completed" {
-				log.Fatalf("The expression - %s hasn't been solved", expr.Expr)
-			}
 		}
 	}()
 
+	deadline := time.Now().Add(5 * time.Second)
+	for solved, _ := ap.Lookup(exprID); solved.Status != "completed"; solved, _ = ap.Lookup(exprID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("The expression - %s hasn't been solved", expr.Expr)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	grpcSrv.Stop()
 }
 
 func NewfakeAgent() *fakeAg {
@@ -0,0 +1,188 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	testUsersMu sync.Mutex
+	testUsers   = make(map[string]int64)
+)
+
+// testUserID - постоянный ID логина для токенов, которые тесты выпускают без регистрации
+func testUserID(login string) int64 {
+	testUsersMu.Lock()
+	defer testUsersMu.Unlock()
+
+	if _, ok := testUsers[login]; !ok {
+		testUsers[login] = int64(len(testUsers) + 1)
+	}
+	return testUsers[login]
+}
+
+func testJWT(login string) string {
+	return application.AddJWT(login, testUserID(login))
+}
+
+// session регистрирует пользователя и входит, как клиент; возвращает выданный jwt
+func session(t *testing.T, o *application.Orchestrator, login string) string {
+	body, _ := json.Marshal(application.User{Login: login, Password: "123"})
+	o.SignUp(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+
+	rec := httptest.NewRecorder()
+	o.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+
+	var rsp application.Rsp
+	json.NewDecoder(rec.Body).Decode(&rsp)
+	if rsp.Jwt == "" {
+		t.Fatalf("Expected a jwt for %s, but got %d %s", login, rec.Code, rec.Body.String())
+	}
+	return rsp.Jwt
+}
+
+func TestBearerAuthentication(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Тот же обработчик, который слушает RunOrchestrator
+	handler := orchestrator.Handler()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	//// Sign up and sign in are public even with a stale header
+	sessions := make(map[string]string)
+	for _, login := range []string{"User1", "User2"} {
+		body, _ := json.Marshal(application.User{Login: login, Password: "123"})
+		do(http.MethodPost, "/api/v1/register", "Bearer stale", string(body))
+
+		rec := do(http.MethodPost, "/api/v1/login", "Bearer stale", string(body))
+		var session application.Rsp
+		json.NewDecoder(rec.Body).Decode(&session)
+		if session.Jwt == "" {
+			t.Fatalf("Expected a jwt for %s, but got %d %s", login, rec.Code, rec.Body.String())
+		}
+		sessions[login] = "Bearer " + session.Jwt
+	}
+
+	//// The login comes from the token, the body has only the expression
+	rec := do(http.MethodPost, "/api/v1/calculate", sessions["User1"], `{"expression": "1+1"}`)
+	var created application.OrchResJSON
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusCreated || orchestrator.ExprStore[created.ID].Login != "User1" {
+		t.Fatalf("Expected an expression of User1, but got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = do(http.MethodPost, "/api/v1/calculate", sessions["User1"], `{"expression": "1+1", "login": "User2"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a login of another user, but got %d", rec.Code)
+	}
+
+	for _, header := range []string{"Bearer broken", "Basic dXNlcjpwYXNz"} {
+		rec = do(http.MethodPost, "/api/v1/calculate", header, `{"expression": "1+1"}`)
+		var rsp application.ErrorEnvelope
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		if rec.Code != http.StatusUnauthorized || rsp.Error.Code != application.CodeUnauthorized {
+			t.Fatalf("Expected status 401 for %q, but got %d %s", header, rec.Code, rec.Body.String())
+		}
+	}
+
+	//// Reads need no body
+	rec = do(http.MethodGet, "/api/v1/expressions", sessions["User1"], "")
+	var list application.SlExprsResp
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list.Expressions) != 1 || list.Expressions[0].ID != created.ID {
+		t.Fatalf("Unexpected expressions: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = do(http.MethodPost, "/api/v1/expression/id", sessions["User1"], `{"id": "`+created.ID+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec = do(http.MethodPost, "/api/v1/expression/id", sessions["User2"], `{"id": "`+created.ID+`"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for another user, but got %d", rec.Code)
+	}
+
+	if rec = do(http.MethodGet, "/api/v1/templates", sessions["User1"], ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d %s", rec.Code, rec.Body.String())
+	}
+
+	//// API v2 reads the same header
+	if rec = do(http.MethodGet, "/api/v2/expressions/"+created.ID, sessions["User1"], ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from v2, but got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec = do(http.MethodPost, "/api/v2/expressions", sessions["User2"], `{"expression": "2*2"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 from v2, but got %d %s", rec.Code, rec.Body.String())
+	}
+
+	//// Admin reads need the admin token: a session is not enough, and without ADMIN_TOKEN they are closed
+	admin := func(path, session, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if session != "" {
+			req.Header.Set("Authorization", session)
+		}
+		if token != "" {
+			req.Header.Set(application.AdminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, path := range []string{"/api/v1/admin/agents", "/api/v1/admin/cache"} {
+		orchestrator.Config.AdminToken = ""
+		if code := admin(path, "", ""); code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 for %s without ADMIN_TOKEN, but got %d", path, code)
+		}
+
+		orchestrator.Config.AdminToken = testAdminToken
+		if code := admin(path, sessions["User1"], ""); code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 for %s with a user session, but got %d", path, code)
+		}
+		if code := admin(path, "", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 for %s with a wrong admin token, but got %d", path, code)
+		}
+		if code := admin(path, "", testAdminToken); code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s with the admin token, but got %d", path, code)
+		}
+	}
+
+	//// The body is capped before it is parsed
+	huge := `{"expression": "` + strings.Repeat("(", application.MaxBodyBytes) + `"}`
+	if rec = do(http.MethodPost, "/api/v1/calculate", sessions["User1"], huge); rec.Code == http.StatusCreated {
+		t.Fatalf("Expected a body over %d bytes to be rejected, but got %d", application.MaxBodyBytes, rec.Code)
+	}
+
+	//// Old scripts with jwt and login in the body still work
+	body, _ := json.Marshal(application.OrchReqJSON{Expression: "2+2", Login: "User2", JWT: sessions["User2"][len("Bearer "):]})
+	if rec = do(http.MethodPost, "/api/v1/calculate", "", string(body)); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,169 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestBatchSubmission(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "batch.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(application.User{Login: "User", Password: "123"})
+	rec := httptest.NewRecorder()
+	orchestrator.SignUp(rec, httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	orchestrator.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+
+	var session application.Rsp
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	batch := func(items []application.BatchItem) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(application.BatchReqJSON{Expressions: items, Login: "User", JWT: session.Jwt})
+		rec := httptest.NewRecorder()
+		orchestrator.BatchHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/calculate/batch", bytes.NewBuffer(body)))
+		return rec
+	}
+
+	item := func(key, expression string) application.BatchItem {
+		return application.BatchItem{Key: key, OrchReqJSON: application.OrchReqJSON{Expression: expression}}
+	}
+
+	rec = batch([]application.BatchItem{
+		item("a", "1+1"),
+		item("b", "2*"),
+		item("c", "(3-1)*2"),
+		item("d", ""),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var rsp application.BatchResJSON
+	json.NewDecoder(rec.Body).Decode(&rsp)
+	if len(rsp.Results) != 4 {
+		t.Fatalf("Expected 4 results, but got %d", len(rsp.Results))
+	}
+
+	for i, key := range []string{"a", "b", "c", "d"} {
+		if rsp.Results[i].Key != key {
+			t.Fatalf("Expected key %s at %d, but got %s", key, i, rsp.Results[i].Key)
+		}
+	}
+	if rsp.Results[0].ID != "1" || rsp.Results[2].ID != "2" {
+		t.Fatalf("Expected IDs 1 and 2, but got %q and %q", rsp.Results[0].ID, rsp.Results[2].ID)
+	}
+	if rsp.Results[1].ID != "" || rsp.Results[1].ParseError == nil {
+		t.Fatalf("Expected a parse error for b, but got %+v", rsp.Results[1])
+	}
+	if rsp.Results[3].Error != "empty expression" {
+		t.Fatalf("Expected empty expression error for d, but got %+v", rsp.Results[3])
+	}
+
+	var stored int
+	if err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM expressions`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 2 || len(orchestrator.ExprStore) != 2 {
+		t.Fatalf("Expected 2 stored expressions, but got %d in the database and %d in memory", stored, len(orchestrator.ExprStore))
+	}
+
+	if rec = batch(nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for an empty batch, but got %d", rec.Code)
+	}
+
+	body, _ = json.Marshal(application.BatchReqJSON{Expressions: []application.BatchItem{item("a", "1+1")}, Login: "User", JWT: "bad"})
+	rec = httptest.NewRecorder()
+	orchestrator.BatchHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/calculate/batch", bytes.NewBuffer(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, but got %d", rec.Code)
+	}
+}
+
+func TestBatchRollbackPublishesNothing(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "batch.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(orchestrator.Handler())
+	defer server.Close()
+
+	jwt := session(t, orchestrator, "User")
+
+	firehose, err := http.Get(server.URL + "/api/v1/events?jwt=" + jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer firehose.Body.Close()
+
+	batch := func(expressions ...string) *httptest.ResponseRecorder {
+		items := make([]application.BatchItem, 0, len(expressions))
+		for _, expression := range expressions {
+			items = append(items, application.BatchItem{OrchReqJSON: application.OrchReqJSON{Expression: expression}})
+		}
+		body, _ := json.Marshal(application.BatchReqJSON{Expressions: items, JWT: jwt})
+		rec := httptest.NewRecorder()
+		orchestrator.BatchHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/calculate/batch", bytes.NewBuffer(body)))
+		return rec
+	}
+
+	//// Numbers complete at submit, but the transaction fails
+	if _, err = db.ExecContext(ctx, `ALTER TABLE expressions RENAME TO expressions_off`); err != nil {
+		t.Fatal(err)
+	}
+	if rec := batch("2", "3"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, but got %d", rec.Code)
+	}
+	if _, err = db.ExecContext(ctx, `ALTER TABLE expressions_off RENAME TO expressions`); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := batch("4")
+	var rsp application.BatchResJSON
+	json.NewDecoder(rec.Body).Decode(&rsp)
+	if rec.Code != http.StatusOK || len(rsp.Results) != 1 {
+		t.Fatalf("Expected status 200, but got %d", rec.Code)
+	}
+
+	//// Only the committed expression reaches the subscriber
+	events := readEvents(t, firehose, func(event application.Event) bool {
+		return event.Status == "completed"
+	})
+	for _, event := range events {
+		if event.ExprID != rsp.Results[0].ID {
+			t.Fatalf("Unexpected event of a rolled back expression: %+v", event)
+		}
+	}
+}
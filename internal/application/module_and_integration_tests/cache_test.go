@@ -0,0 +1,125 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestResultCacheAcrossUsers(t *testing.T) {
+	t.Setenv("CACHE_PERSIST", "true")
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	first := application.NewOrchestrator(db, ctx)
+	if err = first.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	// submit - выражение пользователя login через шаблон; возвращает ID выражения
+	submit := func(o *application.Orchestrator, login, expression string) string {
+		jwt := session(t, o, login)
+
+		body, _ := json.Marshal(application.TemplateReq{Name: "t", Expression: expression, JWT: jwt})
+		rec := httptest.NewRecorder()
+		o.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d", rec.Code)
+		}
+
+		body, _ = json.Marshal(application.TemplateReq{JWT: jwt})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/t/evaluate", bytes.NewBuffer(body))
+		req.SetPathValue("name", "t")
+		rec = httptest.NewRecorder()
+		o.EvaluateTemplate(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		return rsp.ID
+	}
+
+	run := func(o *application.Orchestrator) int {
+		n := 0
+		for {
+			rs, err := o.Get(ctx, &pb.Empty{})
+			if err != nil {
+				return n
+			}
+			n++
+
+			var result float64
+			switch rs.Operation {
+			case "+":
+				result = rs.Arg1 + rs.Arg2
+			case "*":
+				result = rs.Arg1 * rs.Arg2
+			}
+			if _, err = o.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: result, LeaseId: rs.LeaseId}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	submit(first, "User1", "(2+3)*4")
+	if n := run(first); n != 2 {
+		t.Fatalf("Expected 2 tasks, but got %d", n)
+	}
+
+	//// Another user gets 2+3 from the cache
+	id := submit(first, "User2", "(2+3)*5")
+	if n := run(first); n != 1 {
+		t.Fatalf("Expected 1 task, but got %d", n)
+	}
+	if expr := first.ExprStore[id]; expr.Status != "completed" || expr.Result != "25" {
+		t.Fatalf("Expected completed expression with result 25, but got %s %s", expr.Status, expr.Result)
+	}
+
+	first.Config.AdminToken = testAdminToken
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache", nil)
+	req.Header.Set(application.AdminTokenHeader, testAdminToken)
+	rec := httptest.NewRecorder()
+	first.CacheOutput(rec, req)
+
+	var stats application.CacheStats
+	json.NewDecoder(rec.Body).Decode(&stats)
+	if stats.Size != 3 || stats.Hits != 1 || !stats.Persist {
+		t.Fatalf("Unexpected cache stats: %+v", stats)
+	}
+
+	//// The persisted cache survives a restart: the whole expression is known at once
+	second := application.NewOrchestrator(db, ctx)
+	if err = second.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err = second.LoadCache(); err != nil {
+		t.Fatal(err)
+	}
+	if err = second.LoadExpressions(); err != nil {
+		t.Fatal(err)
+	}
+
+	id = submit(second, "User3", "(2+3)*4")
+	if expr := second.ExprStore[id]; expr.Status != "completed" || expr.Result != "20" {
+		t.Fatalf("Expected completed expression with result 20, but got %s %s", expr.Status, expr.Result)
+	}
+	if n := run(second); n != 0 {
+		t.Fatalf("Expected no tasks, but got %d", n)
+	}
+}
@@ -0,0 +1,98 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCancelExpression(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cancel.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	if err = ap.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := session(t, ap, "User")
+	var userID int64
+	if err = db.QueryRow(`SELECT id FROM users WHERE login = ?`, "User").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+
+	ast, err := application.ParseAST("(1*2)*(3*4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{ID: "1", Expr: "(1*2)*(3*4)", Login: "User", UserID: userID, Status: "pending", AST: ast}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+
+	//// One task is already being computed
+	rs, err := ap.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := func(jwt string) int {
+		body, _ := json.Marshal(application.JWTforExpr{JWT: jwt})
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/expressions/1", bytes.NewBuffer(body))
+		req.SetPathValue("id", "1")
+
+		rec := httptest.NewRecorder()
+		ap.CancelExpression(rec, req)
+		return rec.Code
+	}
+
+	if code := cancel(session(t, ap, "Someone")); code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a foreign expression, but got %d", code)
+	}
+
+	if code := cancel(application.AddJWT("User", 999)); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a jwt that is not the current session, but got %d", code)
+	}
+	if expr.Status == "cancelled" {
+		t.Fatal("Expected the expression not to be cancelled with a superseded jwt")
+	}
+
+	if code := cancel(jwt); code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", code)
+	}
+
+	if expr.Status != "cancelled" {
+		t.Fatalf("Expected cancelled expression, but got %s", expr.Status)
+	}
+
+	if _, err = ap.Get(ctx, &pb.Empty{}); err == nil {
+		t.Fatal("Queued tasks of a cancelled expression must be dropped")
+	}
+
+	//// The late result is ignored
+	if _, err = ap.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: 2, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expr.Status != "cancelled" {
+		t.Fatalf("Expected cancelled expression, but got %s", expr.Status)
+	}
+
+	if code := cancel(jwt); code != http.StatusConflict {
+		t.Fatalf("Expected status 409 for a second cancel, but got %d", code)
+	}
+}
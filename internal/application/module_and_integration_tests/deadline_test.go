@@ -0,0 +1,169 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPriorityAndDeadline(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "deadline.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	evaluate := func(login, expression string, priority int, deadline *time.Time) *httptest.ResponseRecorder {
+		jwt := session(t, orchestrator, login)
+
+		body, _ := json.Marshal(application.TemplateReq{Name: "t", Expression: expression, JWT: jwt})
+		rec := httptest.NewRecorder()
+		orchestrator.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d", rec.Code)
+		}
+
+		body, _ = json.Marshal(application.TemplateReq{Priority: priority, Deadline: deadline, JWT: jwt, NoOptimize: true})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/t/evaluate", bytes.NewBuffer(body))
+		req.SetPathValue("name", "t")
+		rec = httptest.NewRecorder()
+		orchestrator.EvaluateTemplate(rec, req)
+		return rec
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if rec := evaluate("User1", "1+1", 0, &past); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for a deadline in the past, but got %d", rec.Code)
+	}
+
+	//// The urgent expression is served first even though it came later
+	deadline := time.Now().Add(time.Hour)
+	evaluate("User1", "(1+1)*(2+2)", 0, &deadline)
+	rec := evaluate("User2", "3-1", 10, nil)
+
+	var rsp application.OrchResJSON
+	json.NewDecoder(rec.Body).Decode(&rsp)
+	urgent := rsp.ID
+
+	rs, err := orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Operation != "-" {
+		t.Fatalf("Expected the task of the urgent expression, but got %s", rs.Operation)
+	}
+	if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: 2, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+	if expr := orchestrator.ExprStore[urgent]; expr.Status != "completed" || expr.Result != "2" {
+		t.Fatalf("Expected completed expression with result 2, but got %s %s", expr.Status, expr.Result)
+	}
+
+	//// The other expression misses its deadline while one of its tasks is being computed
+	rs, err = orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := orchestrator.TimeoutExpired(deadline.Add(time.Second)); n != 1 {
+		t.Fatalf("Expected 1 timed out expression, but got %d", n)
+	}
+
+	if _, err = orchestrator.Get(ctx, &pb.Empty{}); err == nil {
+		t.Fatal("Expected the remaining tasks to be dropped")
+	}
+
+	// Опоздавший результат принимается, но выражение уже не считается
+	if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: 2, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	expr := orchestrator.ExprStore["1"]
+	if expr.Status != "timed_out" || expr.Result != "" {
+		t.Fatalf("Expected timed out expression, but got %s %s", expr.Status, expr.Result)
+	}
+
+	//// The status and the deadline survive a restart
+	restarted := application.NewOrchestrator(db, ctx)
+	if err = restarted.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err = restarted.LoadExpressions(); err != nil {
+		t.Fatal(err)
+	}
+	if expr = restarted.ExprStore["1"]; expr.Status != "timed_out" || expr.Deadline == nil || !expr.Deadline.Equal(deadline.Truncate(time.Millisecond)) {
+		t.Fatalf("Unexpected restored expression: %s %v", expr.Status, expr.Deadline)
+	}
+	if expr = restarted.ExprStore[urgent]; expr.Priority != 10 {
+		t.Fatalf("Expected restored priority 10, but got %d", expr.Priority)
+	}
+}
+
+func TestTimeoutSaveRetry(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "deadline.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	ast, err := application.ParseAST("1+1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Hour)
+	expr := &application.Expression{ID: "1", Expr: "1+1", Login: "User", Status: "pending", AST: ast, Deadline: &deadline}
+	orchestrator.ExprStore[expr.ID] = expr
+	orchestrator.Tasks(expr)
+	if err = orchestrator.AddExpr(expr, false, db); err != nil {
+		t.Fatal(err)
+	}
+
+	//// The database fails when the deadline passes: the background pass keeps going
+	if _, err = db.Exec(`ALTER TABLE expressions RENAME TO expressions_off`); err != nil {
+		t.Fatal(err)
+	}
+	if n := orchestrator.TimeoutExpired(deadline.Add(time.Second)); n != 1 {
+		t.Fatalf("Expected 1 timed out expression, but got %d", n)
+	}
+	if n := orchestrator.RetryUnsaved(); n != 1 {
+		t.Fatalf("Expected 1 unsaved expression while the database fails, but got %d", n)
+	}
+
+	//// The next pass writes timed_out
+	if _, err = db.Exec(`ALTER TABLE expressions_off RENAME TO expressions`); err != nil {
+		t.Fatal(err)
+	}
+	if n := orchestrator.RetryUnsaved(); n != 0 {
+		t.Fatalf("Expected all expressions saved, but got %d unsaved", n)
+	}
+
+	var status string
+	if err = db.QueryRow(`SELECT status FROM expressions WHERE id = 1`).Scan(&status); err != nil || status != "timed_out" {
+		t.Fatalf("Expected the timed_out status in the database, but got %q %v", status, err)
+	}
+}
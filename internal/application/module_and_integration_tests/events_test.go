@@ -0,0 +1,153 @@
+package application
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// readEvents читает события SSE, пока поток не закончится или stop не вернет true
+func readEvents(t *testing.T, res *http.Response, stop func(event application.Event) bool) []application.Event {
+	events := make([]application.Event, 0)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event application.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+		if stop != nil && stop(event) {
+			break
+		}
+	}
+	return events
+}
+
+func TestExpressionEvents(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/expressions/{id}/events", orchestrator.ExpressionEvents)
+	mux.HandleFunc("GET /api/v1/events", orchestrator.UserEvents)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jwt := map[string]string{"User1": session(t, orchestrator, "User1"), "User2": session(t, orchestrator, "User2")}
+
+	evaluate := func(login, expression string) string {
+		body, _ := json.Marshal(application.TemplateReq{Name: "t", Expression: expression, JWT: jwt[login]})
+		orchestrator.TemplatesHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+
+		body, _ = json.Marshal(application.TemplateReq{JWT: jwt[login]})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/t/evaluate", bytes.NewBuffer(body))
+		req.SetPathValue("name", "t")
+		rec := httptest.NewRecorder()
+		orchestrator.EvaluateTemplate(rec, req)
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		return rsp.ID
+	}
+
+	run := func() {
+		for {
+			rs, err := orchestrator.Get(ctx, &pb.Empty{})
+			if err != nil {
+				return
+			}
+
+			var result float64
+			switch rs.Operation {
+			case "+":
+				result = rs.Arg1 + rs.Arg2
+			case "*":
+				result = rs.Arg1 * rs.Arg2
+			}
+			if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: result, LeaseId: rs.LeaseId}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if res, err := http.Get(server.URL + "/api/v1/events?jwt=bad"); err != nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, but got %v %v", res, err)
+	}
+
+	//// The firehose of User1 sees only the expressions of User1
+	firehose, err := http.Get(server.URL + "/api/v1/events?jwt=" + jwt["User1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer firehose.Body.Close()
+	if firehose.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected content type %s", firehose.Header.Get("Content-Type"))
+	}
+
+	other := evaluate("User2", "2*3")
+	id := evaluate("User1", "(1+2)*3")
+
+	//// The stream of one expression starts with its current status
+	stream, err := http.Get(server.URL + "/api/v1/expressions/" + id + "/events?jwt=" + jwt["User1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	if res, err := http.Get(server.URL + "/api/v1/expressions/" + other + "/events?jwt=" + jwt["User1"]); err != nil || res.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for another user's expression, but got %v %v", res, err)
+	}
+
+	run()
+
+	// Поток выражения закрывается сервером после completed
+	events := readEvents(t, stream, nil)
+	got := make([]string, 0, len(events))
+	for _, event := range events {
+		got = append(got, event.Type+":"+event.Status+event.Value)
+	}
+	if strings.Join(got, " ") != "status:pending status:in_progress node:3 node:9 status:completed" {
+		t.Fatalf("Unexpected events: %v", got)
+	}
+	if last := events[len(events)-1]; last.Result != "9" {
+		t.Fatalf("Expected result 9, but got %s", last.Result)
+	}
+
+	events = readEvents(t, firehose, func(event application.Event) bool {
+		return event.Status == "completed"
+	})
+	for _, event := range events {
+		if event.ExprID != id {
+			t.Fatalf("Unexpected event of expression %s in the firehose of User1", event.ExprID)
+		}
+	}
+	if events[0].Status != "pending" {
+		t.Fatalf("Expected the firehose to start with pending, but got %+v", events[0])
+	}
+}
@@ -0,0 +1,72 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFairScheduling(t *testing.T) {
+	t.Setenv("MAX_INFLIGHT_PER_USER", "1")
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "fair.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	submit := func(id, login, expression string) {
+		ast, err := application.ParseAST(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expr := &application.Expression{ID: id, Expr: expression, Login: login, Status: "pending", AST: ast}
+		orchestrator.ExprStore[expr.ID] = expr
+		orchestrator.Tasks(expr)
+	}
+
+	//// A big expression of User1 does not delay the small one of User2
+	submit("1", "User1", "(1+1)*(2+2)*(3+3)*(4+4)")
+	submit("2", "User2", "5*5")
+
+	first, err := orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Operation != "+" || second.Operation != "*" {
+		t.Fatalf("Expected tasks of both users, but got %s and %s", first.Operation, second.Operation)
+	}
+
+	//// Both users already have a task in flight
+	if _, err = orchestrator.Get(ctx, &pb.Empty{}); err == nil {
+		t.Fatal("Expected no task available")
+	}
+
+	if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: first.Id, Result: first.Arg1 + first.Arg2, LeaseId: first.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Operation != "+" {
+		t.Fatalf("Expected the next task of User1, but got %s", rs.Operation)
+	}
+}
@@ -0,0 +1,80 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFunctionTasks(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "functions.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	orchestrator.Config.TimeFunctions["sqrt"] = 7
+
+	ast, err := application.ParseAST("sqrt(16)+max(1,2,3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{
+		ID:     "1",
+		Expr:   "sqrt(16)+max(1,2,3)",
+		Login:  "User",
+		Status: "pending",
+		AST:    ast,
+	}
+	orchestrator.ExprStore[expr.ID] = expr
+	orchestrator.Tasks(expr)
+
+	if err = orchestrator.AddExpr(expr, false, db); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rs, err := orchestrator.Get(ctx, &pb.Empty{})
+		if err != nil {
+			t.Fatalf("Step %d: %v", i, err)
+		}
+
+		var result float64
+		switch rs.Operation {
+		case "sqrt":
+			if len(rs.Args) != 1 || rs.Args[0] != 16 || rs.OperationTime != 7 {
+				t.Fatalf("Unexpected sqrt task: %v", rs)
+			}
+			result = 4
+		case "max":
+			if len(rs.Args) != 3 {
+				t.Fatalf("Unexpected max task: %v", rs)
+			}
+			result = 3
+		case "+":
+			result = rs.Arg1 + rs.Arg2
+		default:
+			t.Fatalf("Unexpected operation %s", rs.Operation)
+		}
+
+		if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: result, LeaseId: rs.LeaseId}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expr.Status != "completed" || expr.Result != "7" {
+		t.Fatalf("Expected completed expression with result 7, but got %s %s", expr.Status, expr.Result)
+	}
+}
@@ -0,0 +1,96 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "idempotency.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := make(map[string]string)
+	for _, login := range []string{"User1", "User2"} {
+		body, _ := json.Marshal(application.User{Login: login, Password: "123"})
+		orchestrator.SignUp(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+
+		rec := httptest.NewRecorder()
+		orchestrator.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+
+		var session application.Rsp
+		json.NewDecoder(rec.Body).Decode(&session)
+		sessions[login] = session.Jwt
+	}
+
+	calculate := func(login, expression, key string) (*httptest.ResponseRecorder, string) {
+		body, _ := json.Marshal(application.OrchReqJSON{Expression: expression, Login: login, JWT: sessions[login]})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body))
+		if key != "" {
+			req.Header.Set(application.IdempotencyHeader, key)
+		}
+
+		rec := httptest.NewRecorder()
+		orchestrator.CalcHandler(rec, req)
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&rsp)
+		return rec, rsp.ID
+	}
+
+	rec, first := calculate("User1", "1+1", "retry-1")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	//// The retry returns the same expression
+	rec, id := calculate("User1", "1+1", "retry-1")
+	if rec.Code != http.StatusOK || id != first || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("Expected replayed expression %s, but got %d %s", first, rec.Code, id)
+	}
+	if len(orchestrator.ExprStore) != 1 {
+		t.Fatalf("Expected 1 expression, but got %d", len(orchestrator.ExprStore))
+	}
+
+	//// The same key with another expression is an error
+	if rec, _ = calculate("User1", "2+2", "retry-1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, but got %d", rec.Code)
+	}
+
+	//// Keys are scoped per user, and requests without a key are never deduplicated
+	if rec, id = calculate("User2", "1+1", "retry-1"); rec.Code != http.StatusCreated || id == first {
+		t.Fatalf("Expected a new expression for another user, but got %d %s", rec.Code, id)
+	}
+	_, a := calculate("User1", "1+1", "")
+	_, b := calculate("User1", "1+1", "")
+	if a == b {
+		t.Fatalf("Expected different expressions without a key, but got %s twice", a)
+	}
+
+	//// After the retention window the key can be used again
+	if n, err := orchestrator.PurgeIdempotencyKeys(time.Now().Add(48 * time.Hour)); err != nil || n != 2 {
+		t.Fatalf("Expected 2 purged keys, but got %d (%v)", n, err)
+	}
+	if rec, id = calculate("User1", "2+2", "retry-1"); rec.Code != http.StatusCreated || id == first {
+		t.Fatalf("Expected a new expression after the key expired, but got %d %s", rec.Code, id)
+	}
+}
@@ -0,0 +1,79 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLeaseRequeue(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", "teststore.db")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	ap.CreateTables()
+
+	ast, err := application.ParseAST("2*3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{
+		ID:     "1",
+		Expr:   "2*3",
+		Login:  "User",
+		Status: "pending",
+		AST:    ast,
+	}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+
+	//// The first agent takes the task and dies
+	first, err := ap.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ap.Get(ctx, &pb.Empty{}); err == nil {
+		t.Fatal("Leased task must not be handed out twice")
+	}
+
+	if n := ap.RequeueExpired(time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("Expected 1 requeued task, but got %d", n)
+	}
+
+	//// The second agent gets the same task with a new lease
+	second, err := ap.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Id != first.Id || second.LeaseId == first.LeaseId {
+		t.Fatalf("Expected task %s with a new lease, but got task %s, lease %s", first.Id, second.Id, second.LeaseId)
+	}
+
+	_, err = ap.Post(ctx, &pb.PostRequest{Id: first.Id, Result: 100, LeaseId: first.LeaseId})
+	if !errors.Is(err, errorStore.LeaseMismatchErr) {
+		t.Fatalf("Expected late result to be rejected, but got %v", err)
+	}
+
+	if _, err = ap.Post(ctx, &pb.PostRequest{Id: second.Id, Result: 6, LeaseId: second.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expr.Status != "completed" || expr.Result != "6" {
+		t.Fatalf("Expected completed expression with result 6, but got %s %s", expr.Status, expr.Result)
+	}
+}
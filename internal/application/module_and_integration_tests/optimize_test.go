@@ -0,0 +1,113 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOptimizedTasks(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "optimize.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	first := application.NewOrchestrator(db, ctx)
+	if err = first.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := session(t, first, "User")
+
+	body, _ := json.Marshal(application.TemplateReq{Name: "square", Expression: "(a+1)*(a+1) + b*1", JWT: jwt})
+	rec := httptest.NewRecorder()
+	first.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d", rec.Code)
+	}
+
+	evaluate := func(o *application.Orchestrator, noOptimize bool) string {
+		body, _ := json.Marshal(application.TemplateReq{
+			Variables:  map[string]float64{"a": 2, "b": 5},
+			NoOptimize: noOptimize,
+			JWT:        jwt,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/square/evaluate", bytes.NewBuffer(body))
+		req.SetPathValue("name", "square")
+
+		rec := httptest.NewRecorder()
+		o.EvaluateTemplate(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		return rsp.ID
+	}
+
+	// run считает все задачи из очереди и возвращает их количество
+	run := func(o *application.Orchestrator) int {
+		n := 0
+		for {
+			rs, err := o.Get(ctx, &pb.Empty{})
+			if err != nil {
+				return n
+			}
+			n++
+
+			var result float64
+			switch rs.Operation {
+			case "+":
+				result = rs.Arg1 + rs.Arg2
+			case "*":
+				result = rs.Arg1 * rs.Arg2
+			default:
+				t.Fatalf("Unexpected operation %s", rs.Operation)
+			}
+
+			if _, err = o.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: result, LeaseId: rs.LeaseId}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	//// a+1 is shared and b*1 is dropped; the shared node survives a restart
+	id := evaluate(first, false)
+
+	second := application.NewOrchestrator(db, ctx)
+	if err = second.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err = second.LoadExpressions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := run(second); n != 3 {
+		t.Fatalf("Expected 3 tasks, but got %d", n)
+	}
+	if expr := second.ExprStore[id]; expr.Status != "completed" || expr.Result != "14" {
+		t.Fatalf("Expected completed expression with result 14, but got %s %s", expr.Status, expr.Result)
+	}
+
+	//// no_optimize keeps every node
+	id = evaluate(second, true)
+	if n := run(second); n != 5 {
+		t.Fatalf("Expected 5 tasks, but got %d", n)
+	}
+	if expr := second.ExprStore[id]; expr.Status != "completed" || expr.Result != "14" {
+		t.Fatalf("Expected completed expression with result 14, but got %s %s", expr.Status, expr.Result)
+	}
+}
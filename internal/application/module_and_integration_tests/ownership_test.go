@@ -0,0 +1,188 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOwnershipAcrossSessions(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "ownership.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(o *application.Orchestrator, login string) string {
+		body, _ := json.Marshal(application.User{Login: login, Password: "123"})
+		rec := httptest.NewRecorder()
+		o.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+
+		var session application.Rsp
+		json.NewDecoder(rec.Body).Decode(&session)
+		return session.Jwt
+	}
+
+	list := func(o *application.Orchestrator, jwt string) []*application.Expression {
+		body, _ := json.Marshal(application.JWTforExpr{JWT: jwt})
+		rec := httptest.NewRecorder()
+		o.ExpressionsOutput(rec, httptest.NewRequest(http.MethodGet, "/api/v1/expressions", bytes.NewBuffer(body)))
+
+		var rsp application.SlExprsResp
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		return rsp.Expressions
+	}
+
+	byID := func(o *application.Orchestrator, id, jwt string) int {
+		body, _ := json.Marshal(application.IDForExpression{ID: id, JWT: jwt})
+		rec := httptest.NewRecorder()
+		o.ExpressionByID(rec, httptest.NewRequest(http.MethodPost, "/api/v1/expression/id", bytes.NewBuffer(body)))
+		return rec.Code
+	}
+
+	for _, login := range []string{"User1", "User2"} {
+		body, _ := json.Marshal(application.User{Login: login, Password: "123"})
+		orchestrator.SignUp(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+	}
+
+	ids := make([]string, 0, 2)
+	for _, expression := range []string{"1+1", "2*3"} {
+		// Каждое выражение - из своей сессии
+		body, _ := json.Marshal(application.OrchReqJSON{Expression: expression, JWT: signIn(orchestrator, "User1")})
+		rec := httptest.NewRecorder()
+		orchestrator.CalcHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body)))
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d %s", rec.Code, rec.Body.String())
+		}
+		ids = append(ids, rsp.ID)
+	}
+
+	//// A new session sees the expressions of all previous sessions
+	jwt := signIn(orchestrator, "User1")
+	if exprs := list(orchestrator, jwt); len(exprs) != 2 {
+		t.Fatalf("Expected 2 expressions of User1, but got %d", len(exprs))
+	}
+	for _, id := range ids {
+		if code := byID(orchestrator, id, jwt); code != http.StatusOK {
+			t.Fatalf("Expected status 200 for expression %s, but got %d", id, code)
+		}
+	}
+
+	//// Another user sees none of them
+	other := signIn(orchestrator, "User2")
+	if exprs := list(orchestrator, other); len(exprs) != 0 {
+		t.Fatalf("Expected no expressions of User2, but got %d", len(exprs))
+	}
+	if code := byID(orchestrator, ids[0], other); code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for another user, but got %d", code)
+	}
+
+	//// After a restart the owner is restored from the database
+	restarted := application.NewOrchestrator(db, ctx)
+	if err = restarted.LoadExpressions(); err != nil {
+		t.Fatal(err)
+	}
+	jwt = signIn(restarted, "User1")
+	if exprs := list(restarted, jwt); len(exprs) != 2 {
+		t.Fatalf("Expected 2 expressions of User1 after a restart, but got %d", len(exprs))
+	}
+	if code := byID(restarted, ids[1], signIn(restarted, "User2")); code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for another user after a restart, but got %d", code)
+	}
+
+	//// Without a token there is no access at all
+	if code := byID(restarted, ids[0], ""); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 without a token, but got %d", code)
+	}
+}
+
+func TestReadsDoNotChangeExpressions(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "reads.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	handler := orchestrator.Handler()
+	bearer := "Bearer " + session(t, orchestrator, "User")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", bearer)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var created application.OrchResJSON
+	json.NewDecoder(do(http.MethodPost, "/api/v1/calculate", `{"expression": "1/3"}`).Body).Decode(&created)
+
+	rs, err := orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: rs.Arg1 / rs.Arg2, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	//// A cancelled expression whose tree is a single number
+	var userID int64
+	if err = db.QueryRow(`SELECT id FROM users WHERE login = ?`, "User").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	ast, err := application.ParseAST("5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orchestrator.ExprStore["99"] = &application.Expression{ID: "99", Expr: "5", Login: "User", UserID: userID, Status: "cancelled", AST: ast}
+
+	//// v1 reads show the same result as v2 and leave the status alone
+	var v2 application.ExprResp
+	json.NewDecoder(do(http.MethodGet, "/api/v2/expressions/"+created.ID, "").Body).Decode(&v2)
+	if v2.Expression == nil || v2.Expression.Status != "completed" {
+		t.Fatalf("Expected a completed expression from v2, but got %+v", v2.Expression)
+	}
+
+	var byID application.ExprResp
+	json.NewDecoder(do(http.MethodPost, "/api/v1/expression/id", `{"id": "`+created.ID+`"}`).Body).Decode(&byID)
+	if byID.Expression == nil || byID.Expression.Result != v2.Expression.Result {
+		t.Fatalf("Expected result %s from v1, but got %+v", v2.Expression.Result, byID.Expression)
+	}
+
+	var list application.SlExprsResp
+	json.NewDecoder(do(http.MethodGet, "/api/v1/expressions", "").Body).Decode(&list)
+	for _, expr := range list.Expressions {
+		if expr.ID == created.ID && expr.Result != v2.Expression.Result {
+			t.Fatalf("Expected result %s in the v1 list, but got %s", v2.Expression.Result, expr.Result)
+		}
+	}
+
+	if expr, _ := orchestrator.Lookup("99"); expr.Status != "cancelled" || expr.Result != "" {
+		t.Fatalf("Expected the cancelled expression unchanged by reads, but got %s %q", expr.Status, expr.Result)
+	}
+}
@@ -0,0 +1,126 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPrecisionModes(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "precision.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	if err = ap.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := session(t, ap, "User")
+
+	body, _ := json.Marshal(application.TemplateReq{Name: "sum", Expression: "a + b / 3", JWT: jwt})
+	rec := httptest.NewRecorder()
+	ap.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d", rec.Code)
+	}
+
+	evaluate := func(precision string, scale *int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(application.TemplateReq{
+			Variables: map[string]float64{"a": 0.1, "b": 0.2},
+			Precision: precision,
+			Scale:     scale,
+			JWT:       jwt,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/sum/evaluate", bytes.NewBuffer(body))
+		req.SetPathValue("name", "sum")
+
+		rec := httptest.NewRecorder()
+		ap.EvaluateTemplate(rec, req)
+		return rec
+	}
+
+	if rec = evaluate("bogus", nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for an unknown precision, but got %d", rec.Code)
+	}
+
+	tooLarge := application.MaxDecimalScale + 1
+	if rec = evaluate(application.PrecisionDecimal, &tooLarge); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for scale %d, but got %d", tooLarge, rec.Code)
+	}
+
+	scale := 3
+	ids := make(map[string]string)
+	for _, precision := range []string{application.PrecisionDecimal, application.PrecisionRational, ""} {
+		if rec = evaluate(precision, &scale); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		ids[precision] = rsp.ID
+	}
+
+	//// The agent gets exact arguments and returns an exact result
+	for {
+		rs, err := ap.Get(ctx, &pb.Empty{})
+		if err != nil {
+			break
+		}
+
+		req := &pb.PostRequest{Id: rs.Id, LeaseId: rs.LeaseId}
+		if rs.Precision == "" {
+			switch rs.Operation {
+			case "+":
+				req.Result = rs.Arg1 + rs.Arg2
+			case "/":
+				req.Result = rs.Arg1 / rs.Arg2
+			}
+		} else {
+			if len(rs.ExactArgs) != 2 {
+				t.Fatalf("Expected two exact arguments, but got %v", rs.ExactArgs)
+			}
+
+			a, _ := new(big.Rat).SetString(rs.ExactArgs[0])
+			b, _ := new(big.Rat).SetString(rs.ExactArgs[1])
+			result := new(big.Rat)
+			switch rs.Operation {
+			case "+":
+				result.Add(a, b)
+			case "/":
+				result.Quo(a, b)
+			}
+			req.ExactResult = result.RatString()
+			req.Result, _ = result.Float64()
+		}
+
+		if _, err = ap.Post(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for precision, expected := range map[string]string{
+		application.PrecisionDecimal:  "0.167",
+		application.PrecisionRational: "1/6",
+		"":                            "0.16666667",
+	} {
+		expr := ap.ExprStore[ids[precision]]
+		if expr.Status != "completed" || expr.Result != expected {
+			t.Errorf("Precision %q: expected completed with result %s, but got %s %s", precision, expected, expr.Status, expr.Result)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAgentRegistry(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", "teststore.db")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	ap.Config.AdminToken = testAdminToken
+	ap.CreateTables()
+
+	ast, err := application.ParseAST("2+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{ID: "1", Expr: "2+2", Login: "User", Status: "pending", AST: ast}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+
+	//// The agent registers and takes the task
+	actx := metadata.NewIncomingContext(ctx, metadata.Pairs("agent-id", "agent-1"))
+
+	rs, err := ap.Register(actx, &pb.RegisterRequest{AgentId: "agent-1", Labels: map[string]string{"zone": "a"}, Capacity: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.HeartbeatIntervalMs <= 0 {
+		t.Fatalf("Expected a heartbeat interval, but got %d", rs.HeartbeatIntervalMs)
+	}
+
+	if _, err = ap.Get(actx, &pb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+
+	//// The registry is not served without a session or the admin token
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/agents", nil)
+		req.Header.Set(application.AdminTokenHeader, token)
+		rec := httptest.NewRecorder()
+		ap.AgentsOutput(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 for admin token %q, but got %d", token, rec.Code)
+		}
+	}
+
+	agents := listAgents(t, ap)
+	if len(agents) != 1 || agents[0].ID != "agent-1" || !agents[0].Alive || agents[0].Leased != 1 || agents[0].Labels["zone"] != "a" {
+		t.Fatalf("Unexpected registry: %+v", agents[0])
+	}
+
+	//// Heartbeats stop - the agent is dead and its task is back in the queue
+	if n := ap.ReapAgents(time.Now().Add(time.Minute)); n != 1 {
+		t.Fatalf("Expected 1 dead agent, but got %d", n)
+	}
+
+	agents = listAgents(t, ap)
+	if agents[0].Alive || agents[0].Leased != 0 {
+		t.Fatalf("Expected the agent to be dead without tasks, but got %+v", agents[0])
+	}
+
+	if _, err = ap.Get(ctx, &pb.Empty{}); err != nil {
+		t.Fatal("Expected the released task back in the queue")
+	}
+
+	if _, err = ap.Heartbeat(actx, &pb.HeartbeatRequest{AgentId: "agent-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if agents = listAgents(t, ap); !agents[0].Alive {
+		t.Fatal("Expected the agent to be alive after a heartbeat")
+	}
+}
+
+func TestDuplicateAgentID(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", "teststore.db")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	ap.Config.AdminToken = testAdminToken
+	ap.CreateTables()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpcSrv := grpc.NewServer()
+	pb.RegisterOrchestratorAgentServiceServer(grpcSrv, ap)
+	go grpcSrv.Serve(lis)
+	defer grpcSrv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewOrchestratorAgentServiceClient(conn)
+
+	ast, err := application.ParseAST("2+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{ID: "1", Expr: "2+2", Login: "User", Status: "pending", AST: ast}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+
+	sctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	connect := func(instance string) (pb.OrchestratorAgentService_ConnectClient, error) {
+		mctx := metadata.AppendToOutgoingContext(sctx, "agent-id", "dup", "agent-instance", instance)
+		stream, err := client.Connect(mctx)
+		if err != nil {
+			return nil, err
+		}
+		err = stream.Send(&pb.AgentMessage{Payload: &pb.AgentMessage_Hello{Hello: &pb.Hello{AgentId: "dup", Capacity: 1}}})
+		return stream, err
+	}
+
+	//// The first agent holds the task
+	first, err := connect("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = first.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	//// The second process with the same ID is turned away and the lease survives
+	second, err := connect("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = second.Recv(); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("Expected AlreadyExists for the second stream, but got %v", err)
+	}
+
+	rctx := func(instance string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("agent-id", "dup", "agent-instance", instance))
+	}
+	if _, err = ap.Register(rctx("b"), &pb.RegisterRequest{AgentId: "dup", Capacity: 1}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("Expected AlreadyExists for another process, but got %v", err)
+	}
+	if _, err = ap.Register(rctx("a"), &pb.RegisterRequest{AgentId: "dup", Capacity: 1}); err != nil {
+		t.Fatalf("Expected the connected process to register, but got %v", err)
+	}
+
+	if agents := listAgents(t, ap); len(agents) != 1 || agents[0].Leased != 1 || agents[0].Streams != 1 {
+		t.Fatalf("Expected one agent with its task, but got %+v", agents)
+	}
+}
+
+const testAdminToken = "test-admin-token"
+
+func listAgents(t *testing.T, ap *application.Orchestrator) []*application.AgentInfo {
+	var rs application.AgentsResp
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/agents", nil)
+	req.Header.Set(application.AdminTokenHeader, testAdminToken)
+	rec := httptest.NewRecorder()
+	ap.AgentsOutput(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", rec.Code)
+	}
+
+	if err := json.NewDecoder(rec.Body).Decode(&rs); err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.Agents
+}
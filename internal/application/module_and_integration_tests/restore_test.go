@@ -0,0 +1,97 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRestoreAfterRestart(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "restore.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	//// The first run: one of two tasks is done, then the orchestrator stops
+	first := application.NewOrchestrator(db, ctx)
+	if err = first.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	ast, err := application.ParseAST("(1+2)*(3+4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{
+		ID:     "1",
+		Expr:   "(1+2)*(3+4)",
+		Login:  "User",
+		Status: "pending",
+		AST:    ast,
+	}
+	first.ExprStore[expr.ID] = expr
+	first.Tasks(expr)
+
+	if err = first.AddExpr(expr, false, db); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := first.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = first.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: rs.Arg1 + rs.Arg2, LeaseId: rs.LeaseId}); err != nil {
+		t.Fatal(err)
+	}
+
+	//// The second run picks up the remaining work
+	second := application.NewOrchestrator(db, ctx)
+	if err = second.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = second.LoadExpressions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if second.ExprCounter != 1 {
+		t.Fatalf("Expected expression counter 1, but got %d", second.ExprCounter)
+	}
+
+	for i := 0; i < 2; i++ {
+		rs, err = second.Get(ctx, &pb.Empty{})
+		if err != nil {
+			t.Fatalf("Step %d: %v", i, err)
+		}
+
+		var result float64
+		switch rs.Operation {
+		case "+":
+			result = rs.Arg1 + rs.Arg2
+		case "*":
+			result = rs.Arg1 * rs.Arg2
+		}
+
+		if _, err = second.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: result, LeaseId: rs.LeaseId}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expr = second.ExprStore["1"]; expr.Status != "completed" || expr.Result != "21" {
+		t.Fatalf("Expected completed expression with result 21, but got %s %s", expr.Status, expr.Result)
+	}
+
+	if _, err = second.Get(ctx, &pb.Empty{}); err == nil {
+		t.Fatal("Expected no tasks left")
+	}
+}
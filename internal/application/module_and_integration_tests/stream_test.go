@@ -0,0 +1,113 @@
+package application
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestTaskStream(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", "teststore.db")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	ap.CreateTables()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpcSrv := grpc.NewServer()
+	pb.RegisterOrchestratorAgentServiceServer(grpcSrv, ap)
+	go grpcSrv.Serve(lis)
+	defer grpcSrv.Stop()
+
+	ast, err := application.ParseAST("(1+2)*(3+4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := &application.Expression{
+		ID:     "1",
+		Expr:   "(1+2)*(3+4)",
+		Login:  "User",
+		Status: "pending",
+		AST:    ast,
+	}
+	ap.ExprStore[expr.ID] = expr
+	ap.Tasks(expr)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	stream, err := pb.NewOrchestratorAgentServiceClient(conn).Connect(sctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := &pb.Hello{AgentId: "test-agent", Capacity: 2}
+	if err = stream.Send(&pb.AgentMessage{Payload: &pb.AgentMessage_Hello{Hello: hello}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//// Both additions are pushed at once, the multiplication after their results
+	results := map[string]float64{}
+	for _, want := range []int{2, 1} {
+		tasks := make([]*pb.GetResponse, 0, want)
+		for len(tasks) < want {
+			msg, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tasks = append(tasks, msg.Task)
+		}
+
+		for _, task := range tasks {
+			var result float64
+			switch task.Operation {
+			case "+":
+				result = task.Arg1 + task.Arg2
+			case "*":
+				result = task.Arg1 * task.Arg2
+			}
+			results[task.Operation] = result
+
+			post := &pb.PostRequest{Id: task.Id, Result: result, LeaseId: task.LeaseId}
+			if err = stream.Send(&pb.AgentMessage{Payload: &pb.AgentMessage_Result{Result: post}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if results["*"] != 21 {
+		t.Fatalf("Expected the pushed multiplication 3*7, but got %v", results)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for expr, _ := ap.Lookup("1"); expr.Status != "completed"; expr, _ = ap.Lookup("1") {
+		if time.Now().After(deadline) {
+			t.Fatal("The expression hasn't been solved")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
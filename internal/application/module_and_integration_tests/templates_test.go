@@ -0,0 +1,156 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestTemplates(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "templates.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, ctx)
+	if err = ap.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := session(t, ap, "User")
+
+	body, _ := json.Marshal(application.TemplateReq{Name: "total", Expression: "1", JWT: application.AddJWT("User", 999)})
+	rec := httptest.NewRecorder()
+	if ap.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body))); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a jwt that is not the current session, but got %d", rec.Code)
+	}
+
+	//// Saving the template
+	body, _ = json.Marshal(application.TemplateReq{Name: "total", Expression: "price * (1 + tax) - discount", JWT: jwt})
+	rec = httptest.NewRecorder()
+	ap.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var template application.Template
+	json.NewDecoder(rec.Body).Decode(&template)
+	if len(template.Variables) != 3 || template.Variables[0] != "discount" {
+		t.Fatalf("Unexpected template variables %v", template.Variables)
+	}
+
+	evaluate := func(name, jwt string, variables map[string]float64) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(application.TemplateReq{Variables: variables, JWT: jwt})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/"+name+"/evaluate", bytes.NewBuffer(body))
+		req.SetPathValue("name", name)
+
+		rec := httptest.NewRecorder()
+		ap.EvaluateTemplate(rec, req)
+		return rec
+	}
+
+	if rec = evaluate("total", session(t, ap, "Someone"), nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a foreign template, but got %d", rec.Code)
+	}
+
+	if rec = evaluate("total", application.AddJWT("User", 999), nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a jwt that is not the current session, but got %d", rec.Code)
+	}
+
+	// Поля запроса те же, что у /api/v1/calculate, и проверяются так же
+	body, _ = json.Marshal(application.TemplateReq{Variables: map[string]float64{"price": 100, "tax": 0.2, "discount": 5}, Callback: "not a url", JWT: jwt})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/templates/total/evaluate", bytes.NewBuffer(body))
+	req.SetPathValue("name", "total")
+	rec = httptest.NewRecorder()
+	if ap.EvaluateTemplate(rec, req); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for a wrong callback_url, but got %d", rec.Code)
+	}
+
+	if rec = evaluate("total", jwt, map[string]float64{"price": 100, "tax": 0.2}); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for an unbound variable, but got %d", rec.Code)
+	}
+
+	//// The same formula with different bindings
+	ids := make([]string, 0, 2)
+	for _, variables := range []map[string]float64{
+		{"price": 100, "tax": 0.2, "discount": 20},
+		{"price": 50, "tax": 0.1, "discount": 5},
+	} {
+		rec = evaluate("total", jwt, variables)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, but got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var rsp application.OrchResJSON
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		ids = append(ids, rsp.ID)
+	}
+
+	for {
+		rs, err := ap.Get(ctx, &pb.Empty{})
+		if err != nil {
+			break
+		}
+
+		var result float64
+		switch rs.Operation {
+		case "+":
+			result = rs.Arg1 + rs.Arg2
+		case "-":
+			result = rs.Arg1 - rs.Arg2
+		case "*":
+			result = rs.Arg1 * rs.Arg2
+		}
+
+		if _, err = ap.Post(ctx, &pb.PostRequest{Id: rs.Id, Result: result, LeaseId: rs.LeaseId}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, expected := range []string{"100", "50"} {
+		expr := ap.ExprStore[ids[i]]
+		if expr.Status != "completed" || expr.Result != expected {
+			t.Fatalf("Expression %s: expected completed with result %s, but got %s %s", ids[i], expected, expr.Status, expr.Result)
+		}
+	}
+}
+
+func TestTemplateParseError(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "templates.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	ap := application.NewOrchestrator(db, context.TODO())
+	if err = ap.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(application.TemplateReq{Name: "broken", Expression: "price * (1 + tax", JWT: session(t, ap, "User")})
+	rec := httptest.NewRecorder()
+	ap.TemplatesHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates", bytes.NewBuffer(body)))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, but got %d", rec.Code)
+	}
+
+	var rsp application.OrchResJSON
+	json.NewDecoder(rec.Body).Decode(&rsp)
+	if rsp.ParseError == nil || rsp.ParseError.Offset != 16 || rsp.ParseError.Token != "" {
+		t.Fatalf("Expected parse error at the end of the expression, but got %+v", rsp.ParseError)
+	}
+}
@@ -0,0 +1,120 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRouterV2(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "v2.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	router := orchestrator.Authenticate(orchestrator.RouterV2())
+
+	jwt := map[string]string{"User1": testJWT("User1"), "User2": testJWT("User2")}
+
+	do := func(method, path, login, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if login != "" {
+			req.Header.Set("Authorization", "Bearer "+jwt[login])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	envelope := func(rec *httptest.ResponseRecorder) application.APIError {
+		var rsp application.ErrorEnvelope
+		if err := json.NewDecoder(rec.Body).Decode(&rsp); err != nil {
+			t.Fatalf("Expected an error envelope, but got %s", rec.Body.String())
+		}
+		return rsp.Error
+	}
+
+	//// POST creates an expression, login comes from the token
+	rec := do(http.MethodPost, "/api/v2/expressions", "User1", `{"expression": "2+2*2"}`)
+	var created application.OrchResJSON
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/v2/expressions/"+created.ID {
+		t.Fatalf("Expected status 201 with Location, but got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	do(http.MethodPost, "/api/v2/expressions", "User1", `{"expression": "3*3"}`)
+	do(http.MethodPost, "/api/v2/expressions", "User2", `{"expression": "1+1"}`)
+
+	//// GET reads without a body
+	rec = do(http.MethodGet, "/api/v2/expressions", "User1", "")
+	var list application.ExpressionsResp
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list.Expressions) != 2 || list.Expressions[0].ID != created.ID || list.Expressions[0].Login != "User1" {
+		t.Fatalf("Unexpected expressions of User1: %d %+v", rec.Code, list.Expressions)
+	}
+
+	rec = do(http.MethodGet, "/api/v2/expressions/"+created.ID, "User1", "")
+	var one application.ExprResp
+	json.NewDecoder(rec.Body).Decode(&one)
+	if rec.Code != http.StatusOK || one.Expression.Expr != "2+2*2" || one.Expression.Status != "pending" {
+		t.Fatalf("Unexpected expression: %d %+v", rec.Code, one.Expression)
+	}
+
+	if rec = do(http.MethodGet, "/api/v2/expressions/"+created.ID, "User2", ""); rec.Code != http.StatusNotFound || envelope(rec).Code != application.CodeNotFound {
+		t.Fatalf("Expected 404 for another user's expression, but got %d", rec.Code)
+	}
+
+	//// A user without expressions gets an empty list
+	jwt["User3"] = testJWT("User3")
+	if rec = do(http.MethodGet, "/api/v2/expressions", "User3", ""); rec.Code != http.StatusOK || rec.Body.String() != "{\"expressions\":[]}\n" {
+		t.Fatalf("Expected an empty list, but got %d %s", rec.Code, rec.Body.String())
+	}
+
+	//// Errors come in the same envelope
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		login  string
+		body   string
+		status int
+		code   string
+		allow  string
+	}{
+		{"no token", http.MethodGet, "/api/v2/expressions", "", "", http.StatusUnauthorized, application.CodeUnauthorized, ""},
+		{"delete list", http.MethodDelete, "/api/v2/expressions", "User1", "", http.StatusMethodNotAllowed, application.CodeMethodNotAllowed, "GET, POST"},
+		{"post one", http.MethodPost, "/api/v2/expressions/1", "User1", "", http.StatusMethodNotAllowed, application.CodeMethodNotAllowed, "GET"},
+		{"unknown path", http.MethodGet, "/api/v2/unknown", "User1", "", http.StatusNotFound, application.CodeNotFound, ""},
+		{"bad body", http.MethodPost, "/api/v2/expressions", "User1", `{"expr": "1"}`, http.StatusBadRequest, application.CodeInvalidBody, ""},
+		{"bad expression", http.MethodPost, "/api/v2/expressions", "User1", `{"expression": "2+"}`, http.StatusUnprocessableEntity, application.CodeInvalidExpression, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(tc.method, tc.path, tc.login, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("Expected status %d, but got %d", tc.status, rec.Code)
+			}
+			if rec.Header().Get("Allow") != tc.allow {
+				t.Fatalf("Expected Allow %q, but got %q", tc.allow, rec.Header().Get("Allow"))
+			}
+			if apiErr := envelope(rec); apiErr.Code != tc.code || apiErr.Message == "" {
+				t.Fatalf("Expected error code %s, but got %+v", tc.code, apiErr)
+			}
+		})
+	}
+}
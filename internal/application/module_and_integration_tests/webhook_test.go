@@ -0,0 +1,266 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "webhook.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	orchestrator.Config.WebhookAttempts = 3
+	orchestrator.Config.WebhookBackoff = 10
+	orchestrator.Config.WebhookAllowPrivate = true // получатель - httptest на 127.0.0.1
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(application.User{Login: "User1", Password: "123"})
+	orchestrator.SignUp(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+	rec := httptest.NewRecorder()
+	orchestrator.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+	var session application.Rsp
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	// Получатель: первая попытка каждой доставки получает 500, вторая - 200
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string]int)
+		received = make(chan application.WebhookPayload, 10)
+		secret   string
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get(application.WebhookSignatureHeader) != application.SignWebhook(secret, r.Header.Get(application.WebhookTimestampHeader), payload) {
+			t.Errorf("Wrong signature of %s", payload)
+		}
+
+		delivery := r.Header.Get(application.WebhookDeliveryHeader)
+		attempts[delivery]++
+		if attempts[delivery] == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var p application.WebhookPayload
+		json.Unmarshal(payload, &p)
+		received <- p
+	}))
+	defer receiver.Close()
+
+	webhook := func(method string, request application.WebhookReq) (int, application.WebhookResp) {
+		request.JWT = session.Jwt
+		body, _ := json.Marshal(request)
+		rec := httptest.NewRecorder()
+		orchestrator.WebhookHandler(rec, httptest.NewRequest(method, "/api/v1/webhook", bytes.NewBuffer(body)))
+
+		var rsp application.WebhookResp
+		json.NewDecoder(rec.Body).Decode(&rsp)
+		return rec.Code, rsp
+	}
+
+	calculate := func(request application.OrchReqJSON) *httptest.ResponseRecorder {
+		request.Login, request.JWT = "User1", session.Jwt
+		body, _ := json.Marshal(request)
+		rec := httptest.NewRecorder()
+		orchestrator.CalcHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body)))
+		return rec
+	}
+
+	accountURL := receiver.URL + "/account"
+	stale := application.WebhookReq{URL: &accountURL, JWT: application.AddJWT("User1", 999)}
+	body, _ = json.Marshal(stale)
+	rec = httptest.NewRecorder()
+	if orchestrator.WebhookHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/webhook", bytes.NewBuffer(body))); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a jwt that is not the current session, but got %d", rec.Code)
+	}
+	if code, _ := webhook(http.MethodPost, application.WebhookReq{URL: &[]string{"ftp://example"}[0]}); code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for a wrong url, but got %d", code)
+	}
+	code, rsp := webhook(http.MethodPost, application.WebhookReq{URL: &accountURL})
+	if code != http.StatusOK || rsp.URL != accountURL || rsp.Secret == "" {
+		t.Fatalf("Unexpected webhook %d %+v", code, rsp)
+	}
+	mu.Lock()
+	secret = rsp.Secret
+	mu.Unlock()
+
+	if _, again := webhook(http.MethodGet, application.WebhookReq{}); again.Secret != secret {
+		t.Fatalf("Expected the secret to stay the same, but got %s", again.Secret)
+	}
+
+	if rec := calculate(application.OrchReqJSON{Expression: "1+1", Callback: "not a url"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for a wrong callback_url, but got %d", rec.Code)
+	}
+
+	//// The account webhook gets the completed expression, the expression's own callback - the failed one
+	calculate(application.OrchReqJSON{Expression: "2+3"})
+	calculate(application.OrchReqJSON{Expression: "1/(2-2)", Callback: receiver.URL + "/expression"})
+
+	for {
+		rs, err := orchestrator.Get(ctx, &pb.Empty{})
+		if err != nil {
+			break
+		}
+
+		post := &pb.PostRequest{Id: rs.Id, LeaseId: rs.LeaseId}
+		switch rs.Operation {
+		case "+":
+			post.Result = rs.Arg1 + rs.Arg2
+		case "-":
+			post.Result = rs.Arg1 - rs.Arg2
+		case "/":
+			post.Error = &pb.TaskError{Code: application.ErrCodeDivisionByZero, Message: "division by zero"}
+		}
+		if _, err = orchestrator.Post(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	payloads := make(map[string]application.WebhookPayload)
+	for range 2 {
+		select {
+		case p := <-received:
+			payloads[p.Event] = p
+		case <-time.After(5 * time.Second):
+			t.Fatal("Webhook was not delivered")
+		}
+	}
+	if p := payloads["expression.completed"]; p.Result != "5" || p.Expression != "2+3" {
+		t.Fatalf("Unexpected completed payload %+v", p)
+	}
+	if p := payloads["expression.failed"]; p.Status != "failed" || p.Reason == "" {
+		t.Fatalf("Unexpected failed payload %+v", p)
+	}
+
+	//// Every attempt is recorded: a failed one and a successful one per delivery
+	var deliveries application.DeliveriesResp
+	for deadline := time.Now().Add(5 * time.Second); len(deliveries.Deliveries) < 4 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		body, _ := json.Marshal(application.WebhookReq{JWT: session.Jwt})
+		rec := httptest.NewRecorder()
+		orchestrator.DeliveriesOutput(rec, httptest.NewRequest(http.MethodGet, "/api/v1/webhook/deliveries", bytes.NewBuffer(body)))
+		json.NewDecoder(rec.Body).Decode(&deliveries)
+	}
+	if len(deliveries.Deliveries) != 4 {
+		t.Fatalf("Expected 4 delivery attempts, but got %+v", deliveries.Deliveries)
+	}
+	codes := make(map[int]int)
+	for _, d := range deliveries.Deliveries {
+		codes[d.StatusCode]++
+		if d.StatusCode == http.StatusInternalServerError && (d.Attempt != 1 || d.Error == "") {
+			t.Fatalf("Unexpected failed attempt %+v", d)
+		}
+	}
+	if codes[http.StatusOK] != 2 || codes[http.StatusInternalServerError] != 2 {
+		t.Fatalf("Expected 2 failed and 2 successful attempts, but got %v", codes)
+	}
+}
+
+func TestWebhookPrivateAddress(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "webhook.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	orchestrator.Config.WebhookAttempts = 2
+	orchestrator.Config.WebhookBackoff = 10
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(application.User{Login: "User1", Password: "123"})
+	orchestrator.SignUp(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+	rec := httptest.NewRecorder()
+	orchestrator.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+	var session application.Rsp
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	received := make(chan struct{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	//// Local and private addresses are refused by default
+	for _, u := range []string{receiver.URL, "http://localhost:8080/hook", "http://10.0.0.1/hook", "http://[fe80::1]/hook", "http://169.254.169.254/latest"} {
+		body, _ := json.Marshal(application.WebhookReq{URL: &u, JWT: session.Jwt})
+		rec := httptest.NewRecorder()
+		orchestrator.WebhookHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/webhook", bytes.NewBuffer(body)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status 422 for %s, but got %d", u, rec.Code)
+		}
+
+		body, _ = json.Marshal(application.OrchReqJSON{Expression: "1+1", Callback: u, Login: "User1", JWT: session.Jwt})
+		rec = httptest.NewRecorder()
+		orchestrator.CalcHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status 422 for callback_url %s, but got %d", u, rec.Code)
+		}
+	}
+
+	//// An address that gets past the check (saved earlier, or a name resolving to a private IP) is refused when dialing
+	if _, err = db.Exec(`UPDATE users SET webhook_url = ? WHERE login = ?`, receiver.URL, "User1"); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ = json.Marshal(application.OrchReqJSON{Expression: "1+1", Login: "User1", JWT: session.Jwt})
+	orchestrator.CalcHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBuffer(body)))
+
+	rs, err := orchestrator.Get(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orchestrator.Post(ctx, &pb.PostRequest{Id: rs.Id, LeaseId: rs.LeaseId, Result: rs.Arg1 + rs.Arg2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var deliveries application.DeliveriesResp
+	for deadline := time.Now().Add(5 * time.Second); len(deliveries.Deliveries) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		body, _ := json.Marshal(application.WebhookReq{JWT: session.Jwt})
+		rec := httptest.NewRecorder()
+		orchestrator.DeliveriesOutput(rec, httptest.NewRequest(http.MethodGet, "/api/v1/webhook/deliveries", bytes.NewBuffer(body)))
+		json.NewDecoder(rec.Body).Decode(&deliveries)
+	}
+	if len(deliveries.Deliveries) != 2 {
+		t.Fatalf("Expected 2 failed attempts, but got %+v", deliveries.Deliveries)
+	}
+	for _, d := range deliveries.Deliveries {
+		if d.StatusCode != 0 || !strings.Contains(d.Error, "private address") {
+			t.Fatalf("Expected the attempt to be refused, but got %+v", d)
+		}
+	}
+
+	select {
+	case <-received:
+		t.Fatal("Webhook reached a private address")
+	default:
+	}
+}
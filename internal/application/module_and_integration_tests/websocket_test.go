@@ -0,0 +1,133 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/internal/application"
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	ctx := context.TODO()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "websocket.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	orchestrator := application.NewOrchestrator(db, ctx)
+	if err = orchestrator.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(application.User{Login: "User1", Password: "123"})
+	orchestrator.SignUp(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewBuffer(body)))
+	rec := httptest.NewRecorder()
+	orchestrator.SignIn(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body)))
+	var session application.Rsp
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/ws", orchestrator.WebSocket())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	exchange := func(request application.WSRequest) application.WSResponse {
+		if err := websocket.JSON.Send(ws, request); err != nil {
+			t.Fatal(err)
+		}
+		return receive(t, ws)
+	}
+
+	//// Expressions are accepted only after signing in
+	if rsp := exchange(application.WSRequest{Type: application.WSSubmit, Ref: "early", OrchReqJSON: application.OrchReqJSON{Expression: "1+1"}}); rsp.Type != application.WSError || rsp.Ref != "early" {
+		t.Fatalf("Expected an error before signing in, but got %+v", rsp)
+	}
+	if rsp := exchange(application.WSRequest{Type: application.WSAuth, OrchReqJSON: application.OrchReqJSON{Login: "User1", JWT: "bad"}}); rsp.Type != application.WSError {
+		t.Fatalf("Expected an error for a wrong jwt, but got %+v", rsp)
+	}
+	if rsp := exchange(application.WSRequest{Type: application.WSAuth, OrchReqJSON: application.OrchReqJSON{Login: "User1", JWT: session.Jwt}}); rsp.Type != application.WSAuth {
+		t.Fatalf("Expected to sign in, but got %+v", rsp)
+	}
+
+	//// An incorrect expression is rejected with the same error as in /api/v1/calculate
+	if rsp := exchange(application.WSRequest{Type: application.WSSubmit, Ref: "bad", OrchReqJSON: application.OrchReqJSON{Expression: "2+"}}); rsp.Type != application.WSError || rsp.Ref != "bad" || rsp.ParseError == nil {
+		t.Fatalf("Expected a parse error, but got %+v", rsp)
+	}
+
+	//// A number completes right away: accepted is followed by the result
+	accepted := exchange(application.WSRequest{Type: application.WSSubmit, Ref: "number", OrchReqJSON: application.OrchReqJSON{Expression: "7"}})
+	if accepted.Type != application.WSAccepted || accepted.ID == "" {
+		t.Fatalf("Expected the expression to be accepted, but got %+v", accepted)
+	}
+	if rsp := receive(t, ws); rsp.Type != application.WSResult || rsp.ID != accepted.ID || rsp.Ref != "number" || rsp.Result != "7" {
+		t.Fatalf("Expected result 7, but got %+v", rsp)
+	}
+
+	//// Results computed by the agents are pushed back with the ID
+	ids := make(map[string]string)
+	for ref, expression := range map[string]string{"sum": "2+3", "div": "1/(2-2)"} {
+		rsp := exchange(application.WSRequest{Type: application.WSSubmit, Ref: ref, OrchReqJSON: application.OrchReqJSON{Expression: expression}})
+		if rsp.Type != application.WSAccepted {
+			t.Fatalf("Expected the expression to be accepted, but got %+v", rsp)
+		}
+		ids[ref] = rsp.ID
+	}
+
+	for {
+		rs, err := orchestrator.Get(ctx, &pb.Empty{})
+		if err != nil {
+			break
+		}
+
+		post := &pb.PostRequest{Id: rs.Id, LeaseId: rs.LeaseId}
+		switch rs.Operation {
+		case "+":
+			post.Result = rs.Arg1 + rs.Arg2
+		case "-":
+			post.Result = rs.Arg1 - rs.Arg2
+		case "/":
+			post.Error = &pb.TaskError{Code: application.ErrCodeDivisionByZero, Message: "division by zero"}
+		}
+		if _, err = orchestrator.Post(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := make(map[string]application.WSResponse)
+	for range ids {
+		rsp := receive(t, ws)
+		results[rsp.Ref] = rsp
+	}
+	if rsp := results["sum"]; rsp.ID != ids["sum"] || rsp.Status != "completed" || rsp.Result != "5" {
+		t.Fatalf("Expected result 5, but got %+v", rsp)
+	}
+	if rsp := results["div"]; rsp.ID != ids["div"] || rsp.Status != "failed" || rsp.Reason == "" {
+		t.Fatalf("Expected a failed expression with a reason, but got %+v", rsp)
+	}
+}
+
+func receive(t *testing.T, ws *websocket.Conn) application.WSResponse {
+	var rsp application.WSResponse
+	if err := websocket.JSON.Receive(ws, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	return rsp
+}
@@ -0,0 +1,171 @@
+package application
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Optimize упрощает дерево перед постановкой задач: убирает тождества (x*1, x+0, x^1, ...)
+// и склеивает одинаковые поддеревья, чтобы они считались один раз.
+// В режиме decimal тождества не применяются: там каждая операция округляет результат до scale.
+// Поддеревья из одних чисел (2+3) не сворачиваются намеренно: каждая операция - задача для агента
+func Optimize(root *ASTNode, precision string) *ASTNode {
+	if precision != PrecisionDecimal {
+		root = simplify(root, precision)
+	}
+	return shareSubtrees(root)
+}
+
+func simplify(node *ASTNode, precision string) *ASTNode {
+	if node == nil || node.IsLeaf || node.Variable != "" {
+		return node
+	}
+
+	if len(node.Args) > 0 {
+		for i, arg := range node.Args {
+			node.Args[i] = simplify(arg, precision)
+		}
+		return node
+	}
+
+	node.Left = simplify(node.Left, precision)
+	node.Right = simplify(node.Right, precision)
+	left, right := node.Left, node.Right
+
+	switch node.Operator {
+	case "+":
+		if isNumber(right, 0) {
+			return left
+		}
+		if isNumber(left, 0) {
+			return right
+		}
+	case "-":
+		if isNumber(right, 0) {
+			return left
+		}
+	case "*":
+		if isNumber(right, 1) {
+			return left
+		}
+		if isNumber(left, 1) {
+			return right
+		}
+		if (isNumber(left, 0) && zeroTimes(right, precision)) || (isNumber(right, 0) && zeroTimes(left, precision)) {
+			return constantNode(0, node.Pos)
+		}
+	case "/":
+		if isNumber(right, 1) {
+			return left
+		}
+	case "^":
+		if isNumber(right, 1) {
+			return left
+		}
+		if (isNumber(right, 0) && !canFail(left)) || (isNumber(left, 1) && !canFail(right)) {
+			return constantNode(1, node.Pos)
+		}
+	}
+
+	return node
+}
+
+// isNumber - узел уже известен и точно равен value
+func isNumber(node *ASTNode, value int64) bool {
+	if node == nil || !node.IsLeaf {
+		return false
+	}
+
+	r, ok := new(big.Rat).SetString(node.ExactValue())
+	return ok && r.Cmp(big.NewRat(value, 1)) == 0
+}
+
+// zeroTimes - 0*node точно равно 0. 0*(1/0) должно упасть у агента, поэтому множитель не должен давать ошибку;
+// в float64 он еще может переполниться до ±Inf (0*(1e308*10) - NaN), поэтому там годится только готовое конечное число
+func zeroTimes(node *ASTNode, precision string) bool {
+	if isExact(precision) {
+		return !canFail(node)
+	}
+	return node.IsLeaf && !math.IsInf(node.Value, 0) && !math.IsNaN(node.Value)
+}
+
+// canFail - при вычислении поддерева агент может вернуть ошибку (деление на ноль, sqrt(-1), ...)
+func canFail(node *ASTNode) bool {
+	if node == nil || node.IsLeaf || node.Variable != "" {
+		return false
+	}
+
+	switch node.Operator {
+	case "+", "-", "*", "abs", "min", "max", "round":
+	default:
+		return true
+	}
+
+	for _, child := range node.Children() {
+		if canFail(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func constantNode(value float64, pos int) *ASTNode {
+	node := NewNumberNode(value)
+	node.Exact = big.NewRat(int64(value), 1).RatString()
+	node.Pos = pos
+	return node
+}
+
+// shareSubtrees заменяет одинаковые поддеревья одним узлом: его задача ставится в очередь один раз,
+// а результат сразу виден всем родителям. Уже запланированные узлы сравниваются по ID задачи,
+// поэтому после перезапуска копии одного узла из JSON снова становятся одним узлом
+func shareSubtrees(root *ASTNode) *ASTNode {
+	seen := make(map[string]*ASTNode)
+	keys := make(map[*ASTNode]string)
+
+	var share func(node *ASTNode) *ASTNode
+	share = func(node *ASTNode) *ASTNode {
+		if node == nil {
+			return nil
+		}
+		if _, ok := keys[node]; ok {
+			return node
+		}
+
+		var key strings.Builder
+		switch {
+		case node.IsLeaf:
+			key.WriteString("n:" + node.ExactValue())
+		case node.Variable != "":
+			key.WriteString("v:" + node.Variable)
+		default:
+			if len(node.Args) > 0 {
+				for i, arg := range node.Args {
+					node.Args[i] = share(arg)
+				}
+			} else {
+				node.Left = share(node.Left)
+				node.Right = share(node.Right)
+			}
+
+			key.WriteString("(" + node.Operator)
+			if node.TaskScheduled {
+				key.WriteString("#" + node.TaskID)
+			}
+			for _, child := range node.Children() {
+				key.WriteString(" " + keys[child])
+			}
+			key.WriteString(")")
+		}
+
+		if existing, ok := seen[key.String()]; ok {
+			return existing
+		}
+		seen[key.String()] = node
+		keys[node] = key.String()
+		return node
+	}
+
+	return share(root)
+}
@@ -0,0 +1,89 @@
+package application
+
+import "testing"
+
+// countOperators считает узлы, которые уйдут агентам; общий узел считается один раз
+func countOperators(node *ASTNode, seen map[*ASTNode]bool) int {
+	if node == nil || node.IsLeaf || seen[node] {
+		return 0
+	}
+	seen[node] = true
+
+	n := 1
+	for _, child := range node.Children() {
+		n += countOperators(child, seen)
+	}
+	return n
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		expression string
+		precision  string
+		operators  int
+		expected   float64
+	}{
+		{"x*1", "", 0, 7},
+		{"1*x+0", "", 0, 7},
+		{"(x-0)/1", "", 0, 7},
+		{"x^1+x^0", "", 1, 8},
+		{"0*x", "", 0, 0},
+		{"0*(x+2)", "", 2, 0}, // в float64 множитель может переполниться, а 0*Inf - NaN, не 0
+		{"0*(x+2)", PrecisionRational, 0, 0},
+		{"0*(1/(x-7))", PrecisionRational, 3, 0}, // деление на ноль должно остаться у агента
+		{"2+3", "", 1, 5},                        // числа не сворачиваются: это задача агента
+		{"(x+1)*(x+1)", "", 2, 64},
+		{"sqrt(x+2)+sqrt(x+2)", "", 3, 6},
+		{"(x+1)*(x+1)", PrecisionDecimal, 2, 64},
+		{"x*1", PrecisionDecimal, 1, 7}, // в decimal каждая операция округляется - тождества не применяются
+		{"x*1.0000000000000000001", PrecisionRational, 1, 7},
+		{"(x+1)*(1+x)", "", 3, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression+" "+tt.precision, func(t *testing.T) {
+			ast, err := ParseAST(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = BindVariables(ast, map[string]float64{"x": 7}); err != nil {
+				t.Fatal(err)
+			}
+
+			ast = Optimize(ast, tt.precision)
+
+			if n := countOperators(ast, map[*ASTNode]bool{}); n != tt.operators {
+				t.Errorf("Expected %d operators, but got %d", tt.operators, n)
+			}
+
+			if tt.expected == 0 && tt.operators > 0 {
+				return
+			}
+			if result, err := Evaluate(ast); err != nil || result != tt.expected {
+				t.Errorf("Expected %v, but got %v (%v)", tt.expected, result, err)
+			}
+		})
+	}
+}
+
+func TestShareSubtreesScheduled(t *testing.T) {
+	ast, err := ParseAST("(1+2)*(1+2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Копии одного запланированного узла после загрузки из JSON
+	ast.Left.TaskScheduled, ast.Left.TaskID = true, "1"
+	ast.Right.TaskScheduled, ast.Right.TaskID = true, "1"
+	if ast = shareSubtrees(ast); ast.Left != ast.Right {
+		t.Fatal("Expected copies of a scheduled node to be shared")
+	}
+
+	// Разные задачи не склеиваются
+	ast, _ = ParseAST("(1+2)*(1+2)")
+	ast.Left.TaskScheduled, ast.Left.TaskID = true, "1"
+	ast.Right.TaskScheduled, ast.Right.TaskID = true, "2"
+	if ast = shareSubtrees(ast); ast.Left == ast.Right {
+		t.Fatal("Expected nodes of different tasks to stay apart")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,10 +23,31 @@ import (
 
 type Config struct {
 	Addr                string
+	GrpcAddr            string
+	EmbeddedAgent       bool
 	TimeAddition        int
 	TimeSubtraction     int
 	TimeMultiplications int
 	TimeDivisions       int
+	TimePower           int
+	TimeModulo          int
+	TimeIntDivision     int
+	TimeFunctions       map[string]int // время выполнения функций по имени
+	DecimalScale        int            // знаков после запятой в режиме decimal, если в запросе не указано
+	CacheSize           int            // записей в кэше результатов, 0 - кэш выключен
+	CacheTTL            int            // сколько миллисекунд хранится результат в кэше
+	CachePersist        bool           // сохранять кэш результатов в SQLite
+	UserWeights         map[string]int // сколько задач пользователь получает за один ход планировщика
+	MaxInflightPerUser  int            // сколько задач одного пользователя могут считаться одновременно, 0 - без ограничения
+	IdempotencyTTL      int            // сколько миллисекунд помнится Idempotency-Key
+	WebhookAttempts     int            // сколько раз пытаться доставить вебхук
+	WebhookBackoff      int            // пауза в миллисекундах перед второй попыткой, дальше удваивается
+	WebhookTimeout      int            // сколько миллисекунд ждать ответа на вебхук
+	WebhookAllowPrivate bool           // разрешить вебхуки на localhost и внутренние адреса
+	AdminToken          string         // токен для /api/v1/admin/* (заголовок X-Admin-Token), пустой - эти методы закрыты
+	LeaseSlack          int
+	HeartbeatInterval   int
+	AgentTTL            int
 }
 
 func ConfigFromEnv() *Config {
@@ -33,6 +55,14 @@ func ConfigFromEnv() *Config {
 	if port == "" {
 		port = "8080"
 	}
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	embedded, err := strconv.ParseBool(os.Getenv("EMBEDDED_AGENT"))
+	if err != nil {
+		embedded = true
+	}
 	ta, _ := strconv.Atoi(os.Getenv("TIME_ADDITION_MS"))
 	if ta == 0 {
 		ta = 100
@@ -49,50 +79,159 @@ func ConfigFromEnv() *Config {
 	if td == 0 {
 		td = 1000
 	}
+	tp, _ := strconv.Atoi(os.Getenv("TIME_POWER_MS"))
+	if tp == 0 {
+		tp = 1000
+	}
+	tmod, _ := strconv.Atoi(os.Getenv("TIME_MODULO_MS"))
+	if tmod == 0 {
+		tmod = 1000
+	}
+	tid, _ := strconv.Atoi(os.Getenv("TIME_INT_DIVISION_MS"))
+	if tid == 0 {
+		tid = 1000
+	}
+	scale, err := strconv.Atoi(os.Getenv("DECIMAL_SCALE"))
+	if err != nil || scale < 0 || scale > MaxDecimalScale {
+		scale = 10
+	}
+	cacheSize, err := strconv.Atoi(os.Getenv("CACHE_SIZE"))
+	if err != nil || cacheSize < 0 {
+		cacheSize = 1000
+	}
+	cacheTTL, _ := strconv.Atoi(os.Getenv("CACHE_TTL_MS"))
+	if cacheTTL == 0 {
+		cacheTTL = 600000
+	}
+	cachePersist, _ := strconv.ParseBool(os.Getenv("CACHE_PERSIST"))
+	inflight, _ := strconv.Atoi(os.Getenv("MAX_INFLIGHT_PER_USER"))
+	idempotencyTTL, _ := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_MS"))
+	if idempotencyTTL == 0 {
+		idempotencyTTL = 86400000
+	}
+	webhookAttempts, _ := strconv.Atoi(os.Getenv("WEBHOOK_ATTEMPTS"))
+	if webhookAttempts <= 0 {
+		webhookAttempts = 5
+	}
+	webhookBackoff, _ := strconv.Atoi(os.Getenv("WEBHOOK_BACKOFF_MS"))
+	if webhookBackoff == 0 {
+		webhookBackoff = 1000
+	}
+	webhookTimeout, _ := strconv.Atoi(os.Getenv("WEBHOOK_TIMEOUT_MS"))
+	if webhookTimeout == 0 {
+		webhookTimeout = 5000
+	}
+	webhookAllowPrivate, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE"))
+	ls, _ := strconv.Atoi(os.Getenv("LEASE_SLACK_MS"))
+	if ls == 0 {
+		ls = 5000
+	}
+	hb, _ := strconv.Atoi(os.Getenv("AGENT_HEARTBEAT_MS"))
+	if hb == 0 {
+		hb = 1000
+	}
+	ttl, _ := strconv.Atoi(os.Getenv("AGENT_TTL_MS"))
+	if ttl == 0 {
+		ttl = 5000
+	}
 
 	return &Config{
 		Addr:                port,
+		GrpcAddr:            grpcAddr,
+		EmbeddedAgent:       embedded,
 		TimeAddition:        ta,
 		TimeSubtraction:     ts,
 		TimeMultiplications: tm,
 		TimeDivisions:       td,
+		TimePower:           tp,
+		TimeModulo:          tmod,
+		TimeIntDivision:     tid,
+		TimeFunctions:       functionTimesFromEnv(),
+		DecimalScale:        scale,
+		CacheSize:           cacheSize,
+		CacheTTL:            cacheTTL,
+		CachePersist:        cachePersist,
+		UserWeights:         userWeightsFromEnv(),
+		MaxInflightPerUser:  inflight,
+		IdempotencyTTL:      idempotencyTTL,
+		WebhookAttempts:     webhookAttempts,
+		WebhookBackoff:      webhookBackoff,
+		WebhookTimeout:      webhookTimeout,
+		WebhookAllowPrivate: webhookAllowPrivate,
+		AdminToken:          os.Getenv("ADMIN_TOKEN"),
+		LeaseSlack:          ls,
+		HeartbeatInterval:   hb,
+		AgentTTL:            ttl,
 	}
 }
 
 type Orchestrator struct {
 	pb.UnsafeOrchestratorAgentServiceServer
-	Config      *Config
-	Db          *sql.DB
-	ExprStore   map[string]*Expression
-	Ctx         context.Context
-	taskStore   map[string]*Task
-	taskQueue   []*Task
-	mu          sync.Mutex
-	ExprCounter int
-	taskCounter int
+	Config       *Config
+	Db           *sql.DB
+	ExprStore    map[string]*Expression
+	Ctx          context.Context
+	taskStore    map[string]*Task
+	queue        *scheduler
+	agents       map[string]*AgentInfo
+	cache        *ResultCache
+	events       *eventHub
+	tx           *sql.Tx                // открыта, пока сохраняется пакет выражений (см. BatchHandler)
+	afterTx      []func()               // события и вебхуки пакета, отправляются после Commit (см. afterCommit)
+	unsaved      map[string]*Expression // завершенные выражения, которые не удалось записать в базу (см. RetryUnsaved)
+	mu           sync.Mutex
+	ExprCounter  int
+	taskCounter  int
+	leaseCounter int
+	wake         chan struct{} // закрывается, когда в очереди появились задачи
 }
 
 func NewOrchestrator(db *sql.DB, ctx context.Context) *Orchestrator {
+	config := ConfigFromEnv()
 	return &Orchestrator{
-		Config:      ConfigFromEnv(),
+		Config:      config,
 		Db:          db,
 		Ctx:         ctx,
 		ExprStore:   make(map[string]*Expression),
 		ExprCounter: 0,
 		taskStore:   make(map[string]*Task),
-		taskQueue:   make([]*Task, 0),
+		queue:       newScheduler(),
+		agents:      make(map[string]*AgentInfo),
+		cache:       newResultCache(config.CacheSize, time.Duration(config.CacheTTL)*time.Millisecond),
+		events:      newEventHub(),
+		unsaved:     make(map[string]*Expression),
+		wake:        make(chan struct{}),
 	}
 }
 
 type OrchReqJSON struct {
-	Expression string `json:"expression"`
-	Login      string `json:"login,omitempty"`
-	JWT        string `json:"jwt,omitempty"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Precision  string             `json:"precision,omitempty"`    // float64 (по умолчанию), decimal или rational
+	Scale      *int               `json:"scale,omitempty"`        // знаков после запятой для decimal
+	NoOptimize bool               `json:"no_optimize,omitempty"`  // считать все узлы дерева, без упрощений
+	Priority   int                `json:"priority,omitempty"`     // задачи выражений с большим приоритетом выдаются раньше
+	Deadline   *time.Time         `json:"deadline,omitempty"`     // RFC 3339; не успели - статус timed_out
+	Callback   string             `json:"callback_url,omitempty"` // сюда придет вебхук, когда выражение завершится
+	Login      string             `json:"login,omitempty"`
+	JWT        string             `json:"jwt,omitempty"`
 }
 
 type OrchResJSON struct {
-	ID    string `json:"id,omitempty"`
-	Error string `json:"error,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	ParseError *ParseError `json:"parse_error,omitempty"` // где именно выражение не разобралось
+}
+
+// exprErrorResp - тело ответа 422; для ошибок разбора добавляется место ошибки
+func exprErrorResp(err error) OrchResJSON {
+	rsp := OrchResJSON{Error: err.Error()}
+
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		rsp.ParseError = parseErr
+	}
+	return rsp
 }
 
 type Expression struct {
@@ -100,26 +239,81 @@ type Expression struct {
 	Expr   string   `json:"expression,omitempty"`
 	Jwt    string   `json:"-"`
 	Login  string   `json:"login,omitempty"`
+	UserID int64    `json:"-"` // владелец, см. Expression.ownedBy
 	Status string   `json:"status,omitempty"`
 	Result string   `json:"result,omitempty"`
+	Reason string   `json:"reason,omitempty"`
 	AST    *ASTNode `json:"-"`
+
+	Variables map[string]float64 `json:"variables,omitempty"`
+	Precision string             `json:"precision,omitempty"`
+	Scale     int                `json:"scale,omitempty"`
+
+	NoOptimize bool       `json:"no_optimize,omitempty"`
+	Priority   int        `json:"priority,omitempty"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Callback   string     `json:"callback_url,omitempty"`
+}
+
+// ownedBy - выражение создано этим пользователем. Сверяется ID из токена, а не сам токен:
+// после нового входа или перезапуска пользователь видит все свои выражения
+func (expr *Expression) ownedBy(id Identity) bool {
+	return id.UserID != 0 && expr.UserID == id.UserID
+}
+
+// formatResult - запись результата посчитанного выражения в его режиме точности
+func (expr *Expression) formatResult() string {
+	if isExact(expr.Precision) {
+		return formatExact(expr.AST.ExactValue(), expr.Precision, expr.Scale)
+	}
+	return strconv.FormatFloat(expr.AST.Value, 'g', 8, 32)
+}
+
+// isFinal - выражение больше не вычисляется
+func isFinal(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled" || status == "timed_out"
 }
 
 type Task struct {
-	ID             string   `json:"id,omitempty"`
-	ExprID         string   `json:"expression,omitempty"`
-	Arg1           float64  `json:"arg1,omitempty"`
-	Arg2           float64  `json:"arg2,omitempty"`
-	Operation      string   `json:"operation,omitempty"`
-	Operation_time int      `json:"operation_time,omitempty"`
-	Node           *ASTNode `json:"-"`
+	ID             string    `json:"id,omitempty"`
+	ExprID         string    `json:"expression,omitempty"`
+	Arg1           float64   `json:"arg1,omitempty"`
+	Arg2           float64   `json:"arg2,omitempty"`
+	Args           []float64 `json:"args,omitempty"` // аргументы функции
+	Precision      string    `json:"precision,omitempty"`
+	Scale          int       `json:"scale,omitempty"`
+	ExactArgs      []string  `json:"exact_args,omitempty"` // аргументы в режимах decimal и rational
+	Operation      string    `json:"operation,omitempty"`
+	Operation_time int       `json:"operation_time,omitempty"`
+	Node           *ASTNode  `json:"-"`
+	Login          string    `json:"-"` // чья задача - по нему планировщик чередует пользователей
+	Priority       int       `json:"-"` // приоритет выражения
+
+	Owner    string    `json:"-"` // агент, который сейчас держит задачу
+	LeaseID  string    `json:"-"` // пустой, пока задача лежит в очереди
+	Deadline time.Time `json:"-"`
 }
 
-var (
-	calc TCalc
-)
+// Lookup - копия выражения на момент вызова; поля самого выражения меняются под o.mu
+func (o *Orchestrator) Lookup(id string) (Expression, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	expr, ok := o.ExprStore[id]
+	if !ok {
+		return Expression{}, false
+	}
+	return *expr, true
+}
 
 func (o *Orchestrator) Tasks(expr *Expression) {
+	queued := o.queue.len()
+	defer func() {
+		if o.queue.len() > queued {
+			o.notify()
+		}
+	}()
+
 	var traverse func(node *ASTNode)
 	traverse = func(node *ASTNode) {
 
@@ -127,12 +321,13 @@ func (o *Orchestrator) Tasks(expr *Expression) {
 			return
 		}
 
-		traverse(node.Left)
-		traverse(node.Right)
-		if node.Left != nil && node.Right != nil && node.Left.IsLeaf && node.Right.IsLeaf {
+		ready := true
+		for _, child := range node.Children() {
+			traverse(child)
+			ready = ready && child != nil && child.IsLeaf
+		}
+		if ready {
 			if !node.TaskScheduled {
-				o.taskCounter++
-				taskID := strconv.Itoa(o.taskCounter)
 				var opTime int
 				switch node.Operator {
 				case "+":
@@ -143,33 +338,75 @@ func (o *Orchestrator) Tasks(expr *Expression) {
 					opTime = o.Config.TimeMultiplications
 				case "/":
 					opTime = o.Config.TimeDivisions
+				case "^":
+					opTime = o.Config.TimePower
+				case "%":
+					opTime = o.Config.TimeModulo
+				case "//":
+					opTime = o.Config.TimeIntDivision
 				default:
 					opTime = 100
+					if t, ok := o.Config.TimeFunctions[node.Operator]; ok {
+						opTime = t
+					}
 				}
 
 				task := &Task{
-					ID:             taskID,
 					ExprID:         expr.ID,
-					Arg1:           node.Left.Value,
-					Arg2:           node.Right.Value,
+					Login:          expr.Login,
+					Priority:       expr.Priority,
 					Operation:      node.Operator,
 					Operation_time: opTime,
 					Node:           node,
 				}
+				if len(node.Args) > 0 {
+					for _, arg := range node.Args {
+						task.Args = append(task.Args, arg.Value)
+					}
+				} else {
+					task.Arg1 = node.Left.Value
+					task.Arg2 = node.Right.Value
+				}
+				if isExact(expr.Precision) {
+					task.Precision = expr.Precision
+					task.Scale = expr.Scale
+					for _, child := range node.Children() {
+						task.ExactArgs = append(task.ExactArgs, child.ExactValue())
+					}
+				}
+				// Такую задачу уже считали (возможно, для другого пользователя); no_optimize - считаем заново
+				if !expr.NoOptimize {
+					if entry, ok := o.cached(task); ok {
+						node.IsLeaf = true
+						node.Value = entry.value
+						node.Exact = entry.exact
+						return
+					}
+				}
+
+				o.taskCounter++
+				taskID := strconv.Itoa(o.taskCounter)
+				task.ID = taskID
 				node.TaskScheduled = true
+				node.TaskID = taskID
 				o.taskStore[taskID] = task
-				o.taskQueue = append(o.taskQueue, task)
+				o.queue.push(task)
+				if err := o.saveTask(task); err != nil {
+					log.Printf("Saving task %s error: %v", taskID, err)
+				}
 			}
 		}
 	}
 	traverse(expr.AST)
+
+	// Например, x*1, просто число или все задачи нашлись в кэше - агентам считать нечего
+	if expr.AST.IsLeaf && !isFinal(expr.Status) {
+		expr.Result = expr.formatResult()
+		o.setStatus(expr, "completed")
+	}
 }
 
 func (o *Orchestrator) CalcHandler(w http.ResponseWriter, r *http.Request) { //Сервер, который принимает арифметическое выражение, переводит его в набор последовательных задач и обеспечивает порядок их выполнения.
-	var (
-		emsg string
-		jwt  string
-	)
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
@@ -186,88 +423,224 @@ func (o *Orchestrator) CalcHandler(w http.ResponseWriter, r *http.Request) { //
 		return
 	}
 
-	if err = o.Db.QueryRowContext(o.Ctx, "SELECT jwt FROM users WHERE login = ?", request.Login).Scan(&jwt); jwt == "" {
+	owner, ok := o.authorize(w, r, request.Login, request.JWT)
+	if !ok {
+		return
+	}
+	request.Login, request.JWT = owner.Login, owner.Token
+
+	id, status, err := o.accept(request, owner.UserID, r.Header.Get(IdempotencyHeader))
+	writeAccepted(w, id, status, err)
+}
+
+// writeAccepted - ответ API v1 на результат accept
+func writeAccepted(w http.ResponseWriter, id string, status int, err error) {
+	switch status {
+	case http.StatusUnprocessableEntity:
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(exprErrorResp(err))
+	case http.StatusInternalServerError:
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+	default:
+		if status == http.StatusOK {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(OrchResJSON{ID: id})
+	}
+}
+
+// accept создает выражение по запросу и возвращает его ID со статусом ответа: 201 - создано,
+// 200 - повтор с тем же Idempotency-Key, 422 - ошибка в запросе, 500 - ошибка сервера. Вызывать под o.mu
+func (o *Orchestrator) accept(request *OrchReqJSON, userID int64, key string) (string, int, error) {
+	// Повтор запроса с тем же ключом (например, после таймаута) возвращает уже созданное выражение
+	fingerprint := requestFingerprint(request)
+	if key != "" {
+		if len(key) > maxIdempotencyKey {
+			return "", http.StatusUnprocessableEntity, fmt.Errorf("%s is longer than %d characters", IdempotencyHeader, maxIdempotencyKey)
+		}
+
+		id, found, err := o.idempotent(request.Login, key, fingerprint, time.Now())
+		if errors.Is(err, errorStore.IdempotencyKeyErr) {
+			return "", http.StatusUnprocessableEntity, err
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode("Session time is up, please, sign in again")
-			return
+			log.Println(err)
+			return "", http.StatusInternalServerError, err
+		}
+		if found {
+			return id, http.StatusOK, nil
 		}
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode("Incorrect login")
-		return
 	}
 
-	err = strimJWT(request.Login, request.JWT)
+	expr, err := o.newExpression(request, userID)
+	if err != nil {
+		return "", http.StatusUnprocessableEntity, err
+	}
+
+	if err = o.submit(expr); err != nil {
+		log.Println(err)
+		return "", http.StatusInternalServerError, err
+	}
+
+	if key != "" {
+		if err = o.rememberKey(request.Login, key, fingerprint, expr.ID, time.Now()); err != nil {
+			log.Printf("Saving %s of expression %s error: %v", IdempotencyHeader, expr.ID, err)
+		}
+	}
+
+	return expr.ID, http.StatusCreated, nil
+}
+
+// authorize определяет пользователя по заголовку Authorization или по jwt из тела и сверяет сессию.
+// login в теле необязателен, но если передан - должен совпадать с логином из jwt
+func (o *Orchestrator) authorize(w http.ResponseWriter, r *http.Request, login, token string) (Identity, bool) {
+	id, err := identify(r, token)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode("Session time is up, please, sign in again")
-		return
-	} else if err == nil && request.JWT != jwt {
+		json.NewEncoder(w).Encode(err.Error())
+		return Identity{}, false
+	}
+	if login != "" && login != id.Login {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode("Incorrect jwt(probably from other user)")
-		return
+		return Identity{}, false
 	}
 
-	ok, err := calc.IsCorrectExpression(request.Expression) // Проверяем выражение на наличие ошибок
-
-	if !ok && err != nil { // Присваиваем ошибкам статус-код, выводим их
-		switch {
-		case errors.Is(err, errorStore.EmptyExpressionErr):
-			emsg = errorStore.EmptyExpressionErr.Error()
-
-		case errors.Is(err, errorStore.IncorrectExpressionErr):
-			emsg = errorStore.IncorrectExpressionErr.Error()
+	return id, o.checkSession(w, id.Login, id.Token)
+}
 
-		case errors.Is(err, errorStore.NumToPopMErr): // numtopop > nums' slise length
-			emsg = errorStore.NumToPopMErr.Error()
+// checkSession сверяет jwt с выданным пользователю при входе; при ошибке отвечает 401
+func (o *Orchestrator) checkSession(w http.ResponseWriter, login, token string) bool {
+	if err := o.verifySession(login, token); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(err.Error())
+		return false
+	}
 
-		case errors.Is(err, errorStore.NumToPopZeroErr): // numtopop <= 0
-			emsg = errorStore.NumToPopZeroErr.Error()
+	return true
+}
 
-		case errors.Is(err, errorStore.NthToPopErr): // no operator to pop
-			emsg = errorStore.NthToPopErr.Error()
+// verifySession - проверка checkSession без ответа, для соединений не по HTTP
+func (o *Orchestrator) verifySession(login, token string) error {
+	var jwt string
 
-		case errors.Is(err, errorStore.DvsByZeroErr):
-			emsg = errorStore.DvsByZeroErr.Error()
+	if err := o.Db.QueryRowContext(o.Ctx, "SELECT jwt FROM users WHERE login = ?", login).Scan(&jwt); jwt == "" {
+		if err != nil {
+			return errors.New("Session time is up, please, sign in again")
 		}
+		return errors.New("Incorrect login")
+	}
 
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(OrchResJSON{Error: emsg})
-		return
+	id, err := parseJWT(token)
+	if err != nil {
+		return errors.New("Session time is up, please, sign in again")
+	} else if token != jwt || id.Login != login {
+		return errors.New("Incorrect jwt(probably from other user)")
 	}
 
-	o.ExprCounter++
-	exprID := strconv.Itoa(o.ExprCounter)
+	return nil
+}
+
+// newExpression проверяет запрос и строит из него выражение; ошибки - для ответа 422
+func (o *Orchestrator) newExpression(request *OrchReqJSON, userID int64) (*Expression, error) {
+	if strings.TrimSpace(request.Expression) == "" {
+		return nil, errorStore.EmptyExpressionErr
+	}
 
-	ast, err := ParseAST(request.Expression)
+	ast, err := prepareAST(request.Expression, request.Variables)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusUnprocessableEntity)
-		return
+		return nil, err
 	}
 
 	expr := &Expression{
-		ID:     exprID,
-		Expr:   request.Expression,
-		Jwt:    request.JWT,
-		Login:  request.Login,
-		Status: "pending",
-		AST:    ast,
+		Expr:       request.Expression,
+		Jwt:        request.JWT,
+		Login:      request.Login,
+		UserID:     userID,
+		AST:        ast,
+		Variables:  request.Variables,
+		NoOptimize: request.NoOptimize,
+		Priority:   request.Priority,
+		Callback:   request.Callback,
 	}
 
-	o.ExprStore[exprID] = expr
-	o.Tasks(expr)
+	if expr.Callback != "" {
+		if err = o.checkCallback(expr.Callback); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = o.setPrecision(expr, request.Precision, request.Scale); err != nil {
+		return nil, err
+	}
 
-	err = o.AddExpr(expr, false, o.Db)
+	if err = setDeadline(expr, request.Deadline, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// prepareAST разбирает выражение и подставляет переменные
+func prepareAST(expression string, variables map[string]float64) (*ASTNode, error) {
+	ast, err := ParseAST(expression)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
-		log.Fatal(err)
-		return
+		return nil, err
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(OrchResJSON{ID: exprID})
+	if err = BindVariables(ast, variables); err != nil {
+		return nil, err
+	}
+
+	// После подстановки переменная может оказаться нулевым делителем
+	if err = ValidateAST(ast); err != nil {
+		return nil, err
+	}
 
+	return ast, nil
+}
+
+// setPrecision проверяет режим точности из запроса; scale по умолчанию берется из конфигурации
+func (o *Orchestrator) setPrecision(expr *Expression, precision string, scale *int) error {
+	if !validPrecision(precision) {
+		return fmt.Errorf("unknown precision %q, expected float64, decimal or rational", precision)
+	}
+
+	expr.Precision = precision
+	if precision != PrecisionDecimal {
+		return nil
+	}
+
+	expr.Scale = o.Config.DecimalScale
+	if scale != nil {
+		if *scale < 0 {
+			return fmt.Errorf("scale must not be negative")
+		}
+		if *scale > MaxDecimalScale {
+			return fmt.Errorf("scale must not exceed %d", MaxDecimalScale)
+		}
+		expr.Scale = *scale
+	}
+
+	return nil
+}
+
+// submit присваивает выражению ID, упрощает дерево, ставит его задачи в очередь и сохраняет в базу. Вызывать под o.mu
+func (o *Orchestrator) submit(expr *Expression) error {
+	o.ExprCounter++
+	expr.ID = strconv.Itoa(o.ExprCounter)
+	o.setStatus(expr, "pending")
+
+	if !expr.NoOptimize {
+		expr.AST = Optimize(expr.AST, expr.Precision)
+	}
+
+	o.ExprStore[expr.ID] = expr
+	o.Tasks(expr)
+
+	return o.AddExpr(expr, false, o.Db)
 }
 
 func (o *Orchestrator) Get(ctx context.Context, _ *pb.Empty) (*pb.GetResponse, error) {
@@ -275,21 +648,71 @@ func (o *Orchestrator) Get(ctx context.Context, _ *pb.Empty) (*pb.GetResponse, e
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if len(o.taskQueue) == 0 {
+	task := o.take(taskOwner(ctx))
+	if task == nil {
 		return &pb.GetResponse{}, fmt.Errorf("No task available")
 	}
 
-	task := o.taskQueue[0]
-	o.taskQueue = o.taskQueue[1:]
+	return task.response(), nil
+}
 
-	if expr, exists := o.ExprStore[task.ExprID]; exists {
-		expr.Status = "in_progress"
+func (o *Orchestrator) Post(ctx context.Context, in *pb.PostRequest) (*pb.Empty, error) {
+	return o.post(in, taskOwner(ctx))
+}
+
+// take достает задачу следующего по кругу пользователя и выдает ее агенту owner.
+// Пользователи, у которых уже MaxInflightPerUser задач в работе, пропускаются. Вызывать под o.mu
+func (o *Orchestrator) take(owner string) *Task {
+	leased := o.inFlight()
+	blocked := func(login string) bool {
+		return o.Config.MaxInflightPerUser > 0 && leased[login] >= o.Config.MaxInflightPerUser
 	}
 
-	return &pb.GetResponse{Id: task.ID, Arg1: task.Arg1, Arg2: task.Arg2, Operation: task.Operation, OperationTime: int32(task.Operation_time)}, nil
+	for {
+		task := o.queue.pop(o.userWeight, blocked)
+		if task == nil {
+			return nil
+		}
+
+		expr, exists := o.ExprStore[task.ExprID]
+		if exists && !isFinal(expr.Status) && expr.missed(time.Now()) {
+			o.timeoutExpr(expr)
+		}
+		if exists && isFinal(expr.Status) {
+			// Например, задача отмененного выражения вернулась в очередь по истечении аренды
+			o.forgetTask(task.ID)
+			continue
+		}
+
+		o.lease(task, owner)
+		if exists {
+			o.setStatus(expr, "in_progress")
+		}
+
+		return task
+	}
 }
 
-func (o *Orchestrator) Post(ctx context.Context, in *pb.PostRequest) (*pb.Empty, error) {
+// forgetTask удаляет задачу из хранилища и базы. Вызывать под o.mu
+func (o *Orchestrator) forgetTask(id string) {
+	delete(o.taskStore, id)
+	if err := o.deleteTask(id); err != nil {
+		log.Printf("Deleting task %s error: %v", id, err)
+	}
+}
+
+func (t *Task) response() *pb.GetResponse {
+	return &pb.GetResponse{Id: t.ID, Arg1: t.Arg1, Arg2: t.Arg2, Operation: t.Operation, OperationTime: int32(t.Operation_time), LeaseId: t.LeaseID, Args: t.Args,
+		Precision: t.Precision, Scale: int32(t.Scale), ExactArgs: t.ExactArgs}
+}
+
+// notify будит всех, кто ждет задач в потоковых каналах. Вызывать под o.mu
+func (o *Orchestrator) notify() {
+	close(o.wake)
+	o.wake = make(chan struct{})
+}
+
+func (o *Orchestrator) post(in *pb.PostRequest, owner string) (*pb.Empty, error) {
 
 	o.mu.Lock()
 	task, ok := o.taskStore[in.Id]
@@ -299,16 +722,48 @@ func (o *Orchestrator) Post(ctx context.Context, in *pb.PostRequest) (*pb.Empty,
 		return nil, fmt.Errorf("No task available")
 	}
 
+	if err := o.checkLease(task, in.LeaseId, owner); err != nil {
+		o.mu.Unlock()
+		return nil, err
+	}
+
+	o.forgetTask(in.Id)
+
+	// Освободилось место для задач этого пользователя
+	if o.Config.MaxInflightPerUser > 0 && o.queue.has(task.Login) {
+		o.notify()
+	}
+
+	if in.Error == nil {
+		o.cacheResult(task, in.Result, in.ExactResult)
+	}
+
+	if expr, exists := o.ExprStore[task.ExprID]; exists && !isFinal(expr.Status) && expr.missed(time.Now()) {
+		o.timeoutExpr(expr)
+	}
+
+	if expr, exists := o.ExprStore[task.ExprID]; exists && isFinal(expr.Status) {
+		// Выражение отменено или уже завершилось с ошибкой - опоздавший результат не нужен
+		o.mu.Unlock()
+		return &pb.Empty{}, nil
+	}
+
+	if in.Error != nil {
+		if expr, exists := o.ExprStore[task.ExprID]; exists {
+			log.Printf("Task %s of expression %s failed: %s %s", in.Id, expr.ID, in.Error.Code, in.Error.Message)
+			o.failExpr(expr, in.Error.Message)
+		}
+		o.mu.Unlock()
+		return &pb.Empty{}, nil
+	}
+
 	task.Node.IsLeaf = true
 	task.Node.Value = in.Result
-	delete(o.taskStore, in.Id)
+	task.Node.Exact = in.ExactResult
 
 	if expr, exists := o.ExprStore[task.ExprID]; exists {
+		o.publishNode(expr, task)
 		o.Tasks(expr)
-		if expr.AST.IsLeaf {
-			expr.Status = "completed"
-			expr.Result = strconv.FormatFloat(expr.AST.Value, 'g', 8, 32)
-		}
 
 		err := o.AddExpr(expr, true, o.Db)
 		if err != nil {
@@ -320,78 +775,164 @@ func (o *Orchestrator) Post(ctx context.Context, in *pb.PostRequest) (*pb.Empty,
 
 	o.mu.Unlock()
 
-	return nil, nil
+	return &pb.Empty{}, nil
+}
+
+// failExpr завершает выражение с ошибкой и снимает все его задачи. Вызывать под o.mu
+func (o *Orchestrator) failExpr(expr *Expression, reason string) {
+	expr.Reason = reason
+	o.setStatus(expr, "failed")
+	o.dropTasks(expr.ID, false)
+	o.saveFinal(expr)
+}
+
+// saveFinal записывает завершенное выражение в базу. Ошибку базы только логирует: в памяти выражение
+// уже завершено, а запись повторит RetryUnsaved. Вызывать под o.mu
+func (o *Orchestrator) saveFinal(expr *Expression) {
+	if err := o.AddExpr(expr, true, o.Db); err != nil {
+		log.Printf("Saving expression %s error: %v", expr.ID, err)
+		o.unsaved[expr.ID] = expr
+		return
+	}
+	delete(o.unsaved, expr.ID)
 }
 
-func makeAnAtomicExpr(Operation string, Arg1, Arg2 float64) (string, error) {
-	arg1 := strconv.FormatFloat(Arg1, 'g', 8, 32)
-	arg2 := strconv.FormatFloat(Arg2, 'g', 8, 32)
+// RetryUnsaved повторяет запись выражений, которые saveFinal не смог сохранить; возвращает, сколько осталось
+func (o *Orchestrator) RetryUnsaved() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, expr := range o.unsaved {
+		o.saveFinal(expr)
+	}
+	return len(o.unsaved)
+}
 
-	var result string
+// dropTasks убирает задачи выражения из очереди и хранилища; при keepLeased задачи,
+// которые сейчас считают агенты, остаются до их ответа. Вызывать под o.mu
+func (o *Orchestrator) dropTasks(exprID string, keepLeased bool) {
+	o.queue.remove(func(task *Task) bool {
+		return task.ExprID == exprID
+	})
 
-	switch {
-	case Operation == "+":
-		result = arg1 + "+" + arg2
-	case Operation == "-":
-		result = arg1 + "-" + arg2
-	case Operation == "*":
-		result = arg1 + "*" + arg2
-	case Operation == "/":
-		if arg2 == "0" {
-			return "0", errorStore.DvsByZeroErr //DvsByZeroErr
+	for id, task := range o.taskStore {
+		if task.ExprID != exprID || (keepLeased && task.LeaseID != "") {
+			continue
 		}
-		result = arg1 + "/" + arg2
+		o.forgetTask(id)
 	}
-	return result, nil
 }
 
 func (o *Orchestrator) RunOrchestrator() {
-	a := NewAgent()
+	if o.Config.EmbeddedAgent {
+		cfg := AgentConfigFromEnv()
+		cfg.OrchestratorAddr = dialAddr(o.Config.GrpcAddr)
+		go NewAgent(cfg).RunAgent()
+	}
+
+	handler := o.Handler()
 
 	go func() {
-		for i := 0; i < a.ComputingPower; i++ {
-			a.worker()
+		for {
+			time.Sleep(2 * time.Second)
+			o.mu.Lock()
+			if n := o.queue.len(); n > 0 {
+				log.Printf("Pending tasks in queue: %d", n)
+			}
+			o.mu.Unlock()
 		}
 	}()
 
-	mux := http.NewServeMux()
-	http.Handle("/", mux)
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { //можно открыть README.md
-		http.ServeFile(w, r, "..\\README.md")
-	})
-	mux.HandleFunc("/api/v1/calculate", o.CalcHandler)
-	mux.HandleFunc("/api/v1/expressions", o.ExpressionsOutput)
-	mux.HandleFunc("/api/v1/expression/id", o.ExpressionByID)
-	mux.HandleFunc("/api/v1/register", o.SignUp)
-	mux.HandleFunc("/api/v1/login", o.SignIn)
-	mux.HandleFunc("/api/v1/DTBs", o.DTBs)
-	//mux.HandleFunc("/api/v1/DDB", o.DDB)
+	go func() {
+		for {
+			time.Sleep(500 * time.Millisecond)
+			if n := o.RequeueExpired(time.Now()); n > 0 {
+				log.Printf("Requeued %d tasks with expired leases", n)
+			}
+			o.ReapAgents(time.Now())
+			if n := o.RetryUnsaved(); n > 0 {
+				log.Printf("%d finished expressions are not saved yet", n)
+			}
+			if n := o.TimeoutExpired(time.Now()); n > 0 {
+				log.Printf("%d expressions missed their deadline", n)
+			}
+		}
+	}()
 
 	go func() {
 		for {
-			time.Sleep(2 * time.Second)
-			o.mu.Lock()
-			if len(o.taskQueue) > 0 {
-				log.Printf("Pending tasks in queue: %d", len(o.taskQueue))
+			time.Sleep(time.Minute)
+			if _, err := o.PurgeIdempotencyKeys(time.Now()); err != nil {
+				log.Printf("Purging idempotency keys error: %v", err)
 			}
-			o.mu.Unlock()
 		}
 	}()
 
 	go func() {
 		log.Println("HTTP listening on", o.Config.Addr)
-		if err := http.ListenAndServe(":"+o.Config.Addr, mux); err != nil {
+		if err := http.ListenAndServe(":"+o.Config.Addr, handler); err != nil {
 			log.Fatal(err)
 		}
 	}()
 
-	lis, err := net.Listen("tcp", ":9090")
+	lis, err := net.Listen("tcp", o.Config.GrpcAddr)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	grpcSrv := grpc.NewServer()
 	pb.RegisterOrchestratorAgentServiceServer(grpcSrv, o)
-	log.Println("gRPC listening on 9090")
+	log.Println("gRPC listening on", o.Config.GrpcAddr)
 	grpcSrv.Serve(lis)
 }
+
+// Handler - все HTTP-маршруты оркестратора; jwt из заголовка Authorization проверяет Authenticate
+func (o *Orchestrator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { //можно открыть README.md
+		http.ServeFile(w, r, "..\\README.md")
+	})
+	mux.HandleFunc("/api/v1/calculate", o.CalcHandler)
+	mux.HandleFunc("POST /api/v1/calculate/batch", o.BatchHandler)
+	mux.HandleFunc("/api/v1/expressions", o.ExpressionsOutput)
+	mux.HandleFunc("/api/v1/expression/id", o.ExpressionByID)
+	mux.HandleFunc("DELETE /api/v1/expressions/{id}", o.CancelExpression)
+	mux.HandleFunc("GET /api/v1/expressions/{id}/events", o.ExpressionEvents)
+	mux.HandleFunc("GET /api/v1/events", o.UserEvents)
+	mux.Handle("GET /api/v1/ws", o.WebSocket())
+	mux.HandleFunc("/api/v1/webhook", o.WebhookHandler)
+	mux.HandleFunc("GET /api/v1/webhook/deliveries", o.DeliveriesOutput)
+	mux.HandleFunc("/api/v1/templates", o.TemplatesHandler)
+	mux.HandleFunc("POST /api/v1/templates/{name}/evaluate", o.EvaluateTemplate)
+	mux.HandleFunc("/api/v1/register", o.SignUp)
+	mux.HandleFunc("/api/v1/login", o.SignIn)
+	mux.Handle("/api/v2/", o.RouterV2())
+	mux.HandleFunc("/api/v1/DTBs", o.DTBs)
+	mux.HandleFunc("/api/v1/admin/agents", o.AgentsOutput)
+	mux.HandleFunc("/api/v1/admin/cache", o.CacheOutput)
+	//mux.HandleFunc("/api/v1/DDB", o.DDB)
+
+	return o.Authenticate(limitBody(mux))
+}
+
+// MaxBodyBytes - предел тела запроса и сообщения WebSocket; пакет из maxBatchSize выражений в него помещается
+const MaxBodyBytes = 8 << 20
+
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dialAddr - адрес, по которому встроенный агент достучится до gRPC-сервера
+func dialAddr(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,245 @@
+package application
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/MrM2025/rpforcalc/tree/master/calc_go/pkg/errorStore"
+)
+
+// Режимы точности выражения
+const (
+	PrecisionFloat64  = "float64"  // обычная арифметика float64, результат - 8 значащих цифр
+	PrecisionDecimal  = "decimal"  // десятичная арифметика, каждый результат округляется до scale знаков
+	PrecisionRational = "rational" // точные дроби a/b
+)
+
+// maxExactExponent - до какой целой степени возводим точно, дальше - через float64
+const maxExactExponent = 1024
+
+// maxExactBits - предел размера точной степени (числитель и знаменатель в битах), дальше - через float64
+const maxExactBits = 1 << 16
+
+// MaxDecimalScale - предел scale и n в round(x, n): 10^scale считается в big.Int, а результат выводится под o.mu
+const MaxDecimalScale = 1000
+
+func isExact(precision string) bool {
+	return precision == PrecisionDecimal || precision == PrecisionRational
+}
+
+func validPrecision(precision string) bool {
+	return precision == "" || precision == PrecisionFloat64 || isExact(precision)
+}
+
+// exactCalculator считает операцию или функцию над точными аргументами и возвращает дробь a/b.
+// sqrt, log, sin, cos, tan и нецелые степени точно не считаются - они идут через float64
+func exactCalculator(operation string, exactArgs []string, precision string, scale int) (string, error) {
+	args := make([]*big.Rat, len(exactArgs))
+	for i, arg := range exactArgs {
+		r, ok := new(big.Rat).SetString(arg)
+		if !ok {
+			return "", fmt.Errorf("invalid exact argument %q", arg)
+		}
+		args[i] = r
+	}
+
+	var (
+		result *big.Rat
+		err    error
+	)
+	if isFunction(operation) {
+		result, err = exactFunc(operation, args)
+	} else if len(args) == 2 {
+		result, err = exactOperator(operation, args[0], args[1])
+	} else {
+		err = errorStore.UnknownOperatorErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if precision == PrecisionDecimal {
+		result = roundRat(result, scale)
+	}
+
+	return result.RatString(), nil
+}
+
+func exactOperator(operator string, a, b *big.Rat) (*big.Rat, error) {
+	switch operator {
+	case "+":
+		return new(big.Rat).Add(a, b), nil
+	case "-":
+		return new(big.Rat).Sub(a, b), nil
+	case "*":
+		return new(big.Rat).Mul(a, b), nil
+	case "/":
+		if b.Sign() == 0 {
+			return nil, errorStore.DvsByZeroErr
+		}
+		return new(big.Rat).Quo(a, b), nil
+	case "//":
+		if b.Sign() == 0 {
+			return nil, errorStore.DvsByZeroErr
+		}
+		return new(big.Rat).SetInt(floorRat(new(big.Rat).Quo(a, b))), nil
+	case "%":
+		if b.Sign() == 0 {
+			return nil, errorStore.DvsByZeroErr
+		}
+		// Как math.Mod: знак остатка совпадает со знаком делимого
+		q := new(big.Rat).Quo(a, b)
+		trunc := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+		return new(big.Rat).Sub(a, trunc.Mul(trunc, b)), nil
+	case "^":
+		return exactPow(a, b)
+	default:
+		return nil, errorStore.UnknownOperatorErr
+	}
+}
+
+func exactPow(base, exp *big.Rat) (*big.Rat, error) {
+	if !exp.IsInt() || exp.Num().CmpAbs(big.NewInt(maxExactExponent)) > 0 {
+		return floatFallback(func(args []float64) (float64, error) {
+			return calculator("^", args[0], args[1])
+		}, base, exp)
+	}
+
+	n := exp.Num().Int64()
+	if base.Sign() == 0 && n < 0 {
+		return nil, errorStore.OutOfDomainErr
+	}
+
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	if int64(base.Num().BitLen()+base.Denom().BitLen())*abs > maxExactBits {
+		return floatFallback(func(args []float64) (float64, error) {
+			return calculator("^", args[0], args[1])
+		}, base, exp)
+	}
+	e := big.NewInt(abs)
+	num := new(big.Int).Exp(base.Num(), e, nil)
+	denom := new(big.Int).Exp(base.Denom(), e, nil)
+
+	if n < 0 {
+		num, denom = denom, num
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+func exactFunc(name string, args []*big.Rat) (*big.Rat, error) {
+	spec := functions[name]
+	if len(args) < spec.minArgs || (spec.maxArgs >= 0 && len(args) > spec.maxArgs) {
+		return nil, errorStore.UnknownOperatorErr
+	}
+
+	switch name {
+	case "abs":
+		return new(big.Rat).Abs(args[0]), nil
+	case "min", "max":
+		result := args[0]
+		for _, arg := range args[1:] {
+			if (name == "min" && arg.Cmp(result) < 0) || (name == "max" && arg.Cmp(result) > 0) {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	case "round":
+		scale := 0
+		if len(args) == 2 {
+			f, _ := args[1].Float64()
+			scale = roundDigits(f, MaxDecimalScale)
+		}
+		return roundRat(args[0], scale), nil
+	default:
+		return floatFallback(func(args []float64) (float64, error) {
+			return calculateFunc(name, args)
+		}, args...)
+	}
+}
+
+// roundDigits - n из round(x, n) без дробной части, не больше limit по модулю
+func roundDigits(n float64, limit int) int {
+	n = math.Trunc(n)
+	if n > float64(limit) {
+		return limit
+	}
+	if n < -float64(limit) {
+		return -limit
+	}
+	return int(n)
+}
+
+// floatFallback считает через float64 то, что не выражается дробью
+func floatFallback(calc func(args []float64) (float64, error), args ...*big.Rat) (*big.Rat, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		values[i], _ = arg.Float64()
+	}
+
+	result, err := calc(values)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(big.Rat)
+	if r.SetFloat64(result) == nil {
+		return nil, errorStore.OutOfDomainErr
+	}
+	return r, nil
+}
+
+// roundRat округляет до scale знаков после запятой, половину - от нуля
+func roundRat(r *big.Rat, scale int) *big.Rat {
+	digits := int64(scale)
+	if digits < 0 {
+		digits = -digits
+	}
+	pow := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(digits), nil))
+	if scale < 0 {
+		pow.Inv(pow)
+	}
+
+	shifted := new(big.Rat).Mul(r, pow)
+	half := big.NewRat(1, 2)
+	if shifted.Sign() < 0 {
+		half.Neg(half)
+	}
+	shifted.Add(shifted, half)
+
+	// Отбрасываем дробную часть (округление к нулю)
+	rounded := new(big.Rat).SetInt(new(big.Int).Quo(shifted.Num(), shifted.Denom()))
+	return rounded.Quo(rounded, pow)
+}
+
+// floorRat - наибольшее целое, не превосходящее r
+func floorRat(r *big.Rat) *big.Int {
+	// Знаменатель положителен, а Div делит по Евклиду - это и есть округление вниз
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+// formatExact - запись точного результата: decimal - ровно scale знаков после запятой, rational - дробь a/b
+func formatExact(exact, precision string, scale int) string {
+	r, ok := new(big.Rat).SetString(exact)
+	if !ok {
+		return exact
+	}
+
+	if precision == PrecisionDecimal {
+		return roundRat(r, scale).FloatString(scale)
+	}
+	return r.RatString()
+}
+
+// exactFloat - ближайшее к точному значению число float64
+func exactFloat(exact string) float64 {
+	r, ok := new(big.Rat).SetString(exact)
+	if !ok {
+		return 0
+	}
+	f, _ := r.Float64()
+	return f
+}
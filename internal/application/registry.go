@@ -0,0 +1,182 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type AgentInfo struct {
+	ID           string            `json:"id"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Capacity     int               `json:"capacity"`
+	Leased       int               `json:"leased"`
+	Alive        bool              `json:"alive"`
+	Streams      int               `json:"streams"` // открытые потоковые каналы Connect
+	RegisteredAt time.Time         `json:"registered_at"`
+	LastSeen     time.Time         `json:"last_seen"`
+
+	instance string // процесс, который зарегистрировался или открыл канал последним
+}
+
+type AgentsResp struct {
+	Agents []*AgentInfo `json:"agents"`
+}
+
+func (o *Orchestrator) Register(ctx context.Context, in *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if in.AgentId == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent_id is required")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Другой процесс с тем же ID: его задачи вернулись бы в очередь, когда отключится этот
+	instance := agentInstance(ctx)
+	agent, ok := o.agents[in.AgentId]
+	if ok && agent.Streams > 0 && agent.instance != instance {
+		return nil, status.Errorf(codes.AlreadyExists, "agent %s is already connected", in.AgentId)
+	}
+
+	now := time.Now()
+	if !ok {
+		agent = &AgentInfo{ID: in.AgentId}
+		o.agents[in.AgentId] = agent
+	}
+	agent.instance = instance
+	agent.Labels = in.Labels
+	agent.Capacity = int(in.Capacity)
+	agent.Alive = true
+	agent.RegisteredAt = now
+	agent.LastSeen = now
+	log.Printf("Agent %s registered with capacity %d", in.AgentId, in.Capacity)
+
+	return &pb.RegisterResponse{HeartbeatIntervalMs: int32(o.Config.HeartbeatInterval)}, nil
+}
+
+func (o *Orchestrator) Heartbeat(ctx context.Context, in *pb.HeartbeatRequest) (*pb.Empty, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	agent, ok := o.agents[in.AgentId]
+	if !ok {
+		// Оркестратор перезапускался или агента уже удалили - пусть зарегистрируется заново
+		return nil, status.Error(codes.NotFound, "agent is not registered")
+	}
+
+	if !agent.Alive {
+		log.Printf("Agent %s is back", agent.ID)
+	}
+	agent.Alive = true
+	agent.LastSeen = time.Now()
+
+	return &pb.Empty{}, nil
+}
+
+// openStream учитывает канал Connect: пока он открыт, агент считается живым.
+// Второй канал с тем же ID не открывается. Незнакомые агенты попадают в реестр без меток. Вызывать под o.mu
+func (o *Orchestrator) openStream(id, instance string, capacity int) error {
+	now := time.Now()
+	agent, ok := o.agents[id]
+	if ok && agent.Streams > 0 {
+		return status.Errorf(codes.AlreadyExists, "agent %s is already connected", id)
+	}
+	if !ok {
+		agent = &AgentInfo{ID: id, RegisteredAt: now}
+		o.agents[id] = agent
+	}
+	agent.instance = instance
+	agent.Capacity = capacity
+	agent.Alive = true
+	agent.LastSeen = now
+	agent.Streams++
+	return nil
+}
+
+// closeStream - канал Connect закрыт. Вызывать под o.mu
+func (o *Orchestrator) closeStream(id string) {
+	if agent, ok := o.agents[id]; ok && agent.Streams > 0 {
+		agent.Streams--
+		agent.LastSeen = time.Now()
+	}
+}
+
+// ReapAgents помечает мертвыми агентов без heartbeat дольше AgentTTL и возвращает их задачи в очередь
+func (o *Orchestrator) ReapAgents(now time.Time) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ttl := time.Duration(o.Config.AgentTTL) * time.Millisecond
+	dead := 0
+	for id, agent := range o.agents {
+		if agent.Streams > 0 {
+			agent.LastSeen = now
+			continue
+		}
+
+		idle := now.Sub(agent.LastSeen)
+
+		if !agent.Alive && idle > 10*ttl {
+			delete(o.agents, id)
+			continue
+		}
+
+		if !agent.Alive || idle <= ttl {
+			continue
+		}
+
+		agent.Alive = false
+		dead++
+		n := o.requeueWhere(func(task *Task) bool {
+			return task.LeaseID != "" && task.Owner == id
+		})
+		log.Printf("Agent %s stopped sending heartbeats, %d tasks returned to the queue", id, n)
+	}
+
+	return dead
+}
+
+// AgentsOutput - реестр агентов для эксплуатации
+func (o *Orchestrator) AgentsOutput(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !o.authorizeAdmin(w, r) {
+		return
+	}
+
+	leased := make(map[string]int)
+	for _, task := range o.taskStore {
+		if task.LeaseID != "" {
+			leased[task.Owner]++
+		}
+	}
+
+	agents := make([]*AgentInfo, 0, len(o.agents))
+	for _, agent := range o.agents {
+		info := *agent
+		info.Leased = leased[agent.ID]
+		agents = append(agents, &info)
+	}
+
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].ID < agents[j].ID
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(AgentsResp{Agents: agents})
+}
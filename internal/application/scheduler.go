@@ -0,0 +1,169 @@
+package application
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// scheduler - очереди задач по пользователям. Пользователи обходятся по кругу, за один ход
+// пользователь получает столько задач подряд, каков его вес, поэтому одно большое выражение
+// не задерживает остальных. Очередь пользователя упорядочена по приоритету, и в обходе
+// участвуют только пользователи с задачами наивысшего приоритета. Вызывать под o.mu
+type scheduler struct {
+	queues map[string][]*Task
+	order  []string // пользователи с задачами в очереди, в порядке обхода
+	next   int      // чей сейчас ход
+	served int      // сколько задач уже выдано в текущем ходе
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{queues: make(map[string][]*Task)}
+}
+
+func (s *scheduler) len() int {
+	n := 0
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// push ставит задачу в конец задач того же приоритета в очереди ее пользователя
+func (s *scheduler) push(task *Task) {
+	s.insert(task, func(queued *Task) bool { return queued.Priority < task.Priority })
+}
+
+// pushFront возвращает задачи в начало задач того же приоритета, сохраняя их порядок
+func (s *scheduler) pushFront(tasks []*Task) {
+	for i := len(tasks) - 1; i >= 0; i-- {
+		task := tasks[i]
+		s.insert(task, func(queued *Task) bool { return queued.Priority <= task.Priority })
+	}
+}
+
+// insert вставляет задачу перед первой задачей очереди, для которой before
+func (s *scheduler) insert(task *Task, before func(queued *Task) bool) {
+	queue := s.queues[task.Login]
+	if len(queue) == 0 {
+		s.order = append(s.order, task.Login)
+	}
+
+	i := 0
+	for i < len(queue) && !before(queue[i]) {
+		i++
+	}
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = task
+	s.queues[task.Login] = queue
+}
+
+// pop выдает задачу наивысшего приоритета следующего по кругу пользователя;
+// пользователи, для которых blocked, пропускаются
+func (s *scheduler) pop(weight func(login string) int, blocked func(login string) bool) *Task {
+	top, found := 0, false
+	for _, login := range s.order {
+		if priority := s.queues[login][0].Priority; !blocked(login) && (!found || priority > top) {
+			top, found = priority, true
+		}
+	}
+
+	for i := 0; i < len(s.order); i++ {
+		login := s.order[s.next]
+		if blocked(login) || s.queues[login][0].Priority < top {
+			s.advance()
+			continue
+		}
+
+		task := s.queues[login][0]
+		s.queues[login] = s.queues[login][1:]
+		s.served++
+
+		if len(s.queues[login]) == 0 {
+			s.drop(s.next)
+		} else if s.served >= weight(login) {
+			s.advance()
+		}
+		return task
+	}
+
+	return nil
+}
+
+// remove убирает из очередей задачи, подходящие под условие
+func (s *scheduler) remove(match func(task *Task) bool) {
+	for i := len(s.order) - 1; i >= 0; i-- {
+		login := s.order[i]
+		queue := s.queues[login][:0]
+		for _, task := range s.queues[login] {
+			if !match(task) {
+				queue = append(queue, task)
+			}
+		}
+		s.queues[login] = queue
+
+		if len(queue) == 0 {
+			s.drop(i)
+		}
+	}
+}
+
+// has - у пользователя есть задачи в очереди
+func (s *scheduler) has(login string) bool {
+	return len(s.queues[login]) > 0
+}
+
+func (s *scheduler) advance() {
+	s.served = 0
+	s.next++
+	if s.next >= len(s.order) {
+		s.next = 0
+	}
+}
+
+// drop убирает из обхода пользователя с пустой очередью
+func (s *scheduler) drop(i int) {
+	delete(s.queues, s.order[i])
+	s.order = append(s.order[:i], s.order[i+1:]...)
+
+	switch {
+	case i < s.next:
+		s.next--
+	case i == s.next:
+		s.served = 0
+	}
+	if s.next >= len(s.order) {
+		s.next = 0
+	}
+}
+
+// userWeightsFromEnv разбирает веса пользователей вида "team-a=3,team-b=1"
+func userWeightsFromEnv() map[string]int {
+	weights := make(map[string]int)
+	for login, w := range parseLabels(os.Getenv("USER_WEIGHTS")) {
+		if n, err := strconv.Atoi(strings.TrimSpace(w)); err == nil && n > 0 {
+			weights[login] = n
+		}
+	}
+	return weights
+}
+
+// userWeight - сколько задач пользователь получает за один ход, по умолчанию 1
+func (o *Orchestrator) userWeight(login string) int {
+	if w, ok := o.Config.UserWeights[login]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// inFlight - сколько задач каждого пользователя сейчас считают агенты. Вызывать под o.mu
+func (o *Orchestrator) inFlight() map[string]int {
+	leased := make(map[string]int)
+	for _, task := range o.taskStore {
+		if task.LeaseID != "" {
+			leased[task.Login]++
+		}
+	}
+	return leased
+}
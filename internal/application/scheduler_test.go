@@ -0,0 +1,105 @@
+package application
+
+import (
+	"strings"
+	"testing"
+)
+
+// drain выдает все задачи и возвращает их ID по порядку
+func drain(s *scheduler, weights map[string]int, blocked func(login string) bool) string {
+	weight := func(login string) int {
+		if w, ok := weights[login]; ok {
+			return w
+		}
+		return 1
+	}
+
+	ids := make([]string, 0)
+	for task := s.pop(weight, blocked); task != nil; task = s.pop(weight, blocked) {
+		ids = append(ids, task.ID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func fill(s *scheduler, ids ...string) {
+	for _, id := range ids {
+		// a1 - первая задача пользователя a
+		s.push(&Task{ID: id, Login: id[:1], ExprID: id[:1]})
+	}
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	never := func(string) bool { return false }
+
+	s := newScheduler()
+	fill(s, "a1", "a2", "a3", "a4", "b1", "c1", "c2")
+	if got := drain(s, nil, never); got != "a1 b1 c1 a2 c2 a3 a4" {
+		t.Fatalf("Unexpected order: %s", got)
+	}
+	if s.len() != 0 || len(s.order) != 0 {
+		t.Fatal("Expected empty scheduler")
+	}
+
+	s = newScheduler()
+	fill(s, "a1", "a2", "a3", "a4", "b1", "b2", "b3")
+	if got := drain(s, map[string]int{"a": 3}, never); got != "a1 a2 a3 b1 a4 b2 b3" {
+		t.Fatalf("Unexpected weighted order: %s", got)
+	}
+
+	s = newScheduler()
+	fill(s, "a1", "a2", "b1", "b2")
+	if got := drain(s, nil, func(login string) bool { return login == "a" }); got != "b1 b2" {
+		t.Fatalf("Unexpected order with a blocked user: %s", got)
+	}
+	if got := drain(s, nil, never); got != "a1 a2" {
+		t.Fatalf("Unexpected order after unblocking: %s", got)
+	}
+}
+
+func TestSchedulerRequeueAndRemove(t *testing.T) {
+	never := func(string) bool { return false }
+
+	s := newScheduler()
+	fill(s, "a2", "b2")
+	s.pushFront([]*Task{{ID: "a1", Login: "a"}, {ID: "c1", Login: "c"}})
+	if got := drain(s, nil, never); got != "a1 b2 c1 a2" {
+		t.Fatalf("Unexpected order after requeue: %s", got)
+	}
+
+	s = newScheduler()
+	fill(s, "a1", "b1", "b2", "c1")
+	s.remove(func(task *Task) bool { return task.ExprID == "b" })
+	if got := drain(s, nil, never); got != "a1 c1" {
+		t.Fatalf("Unexpected order after remove: %s", got)
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	never := func(string) bool { return false }
+
+	s := newScheduler()
+	fill(s, "a1", "a2", "b1")
+	s.push(&Task{ID: "b2", Login: "b", Priority: 5})
+	s.push(&Task{ID: "a3", Login: "a", Priority: 5})
+	s.push(&Task{ID: "c1", Login: "c", Priority: 1})
+	if got := drain(s, nil, never); got != "a3 b2 c1 a1 b1 a2" {
+		t.Fatalf("Unexpected order: %s", got)
+	}
+
+	// Возвращенная задача встает перед задачами того же приоритета, но после более важных
+	s = newScheduler()
+	s.push(&Task{ID: "a1", Login: "a", Priority: 5})
+	s.push(&Task{ID: "a3", Login: "a"})
+	s.pushFront([]*Task{{ID: "a2", Login: "a"}})
+	if got := drain(s, nil, never); got != "a1 a2 a3" {
+		t.Fatalf("Unexpected order after requeue: %s", got)
+	}
+
+	// Заблокированный пользователь не мешает выдавать задачи меньшего приоритета
+	s = newScheduler()
+	s.push(&Task{ID: "a1", Login: "a", Priority: 5})
+	s.push(&Task{ID: "b1", Login: "b"})
+	if got := drain(s, nil, func(login string) bool { return login == "a" }); got != "b1" {
+		t.Fatalf("Unexpected order with a blocked user: %s", got)
+	}
+}
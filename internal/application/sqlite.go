@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
@@ -51,9 +53,70 @@ func (o *Orchestrator) CreateTables() error {
 		status TEXT NOT NULL,
 		result REAL,
 		user_id INTEGER NOT NULL,
+		ast TEXT,
+		reason TEXT,
+		variables TEXT,
+		precision TEXT,
+		scale INTEGER,
+		no_optimize INTEGER NOT NULL DEFAULT 0,
+		priority INTEGER NOT NULL DEFAULT 0,
+		deadline INTEGER NOT NULL DEFAULT 0,
 	
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);`
+
+		tasksTable = `
+	CREATE TABLE IF NOT EXISTS tasks(
+		id INTEGER PRIMARY KEY,
+		expr_id INTEGER NOT NULL,
+		arg1 REAL NOT NULL,
+		arg2 REAL NOT NULL,
+		operation TEXT NOT NULL,
+		operation_time INTEGER NOT NULL
+	);`
+
+		templatesTable = `
+	CREATE TABLE IF NOT EXISTS templates(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_lg TEXT NOT NULL,
+		name TEXT NOT NULL,
+		expression TEXT NOT NULL,
+
+		UNIQUE (user_lg, name)
+	);`
+
+		idempotencyTable = `
+	CREATE TABLE IF NOT EXISTS idempotency_keys(
+		user_lg TEXT NOT NULL,
+		key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		expr_id INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+
+		PRIMARY KEY (user_lg, key)
+	);`
+
+		deliveriesTable = `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		delivery TEXT NOT NULL,
+		user_lg TEXT NOT NULL,
+		expr_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		event TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);`
+
+		cacheTable = `
+	CREATE TABLE IF NOT EXISTS results_cache(
+		key TEXT PRIMARY KEY,
+		value REAL NOT NULL,
+		exact TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	);`
 	)
 
 	if _, err := o.Db.ExecContext(o.Ctx, usersTable); err != nil {
@@ -64,9 +127,94 @@ func (o *Orchestrator) CreateTables() error {
 		return err
 	}
 
+	if _, err := o.Db.ExecContext(o.Ctx, tasksTable); err != nil {
+		return err
+	}
+
+	if _, err := o.Db.ExecContext(o.Ctx, templatesTable); err != nil {
+		return err
+	}
+
+	if _, err := o.Db.ExecContext(o.Ctx, cacheTable); err != nil {
+		return err
+	}
+
+	if _, err := o.Db.ExecContext(o.Ctx, idempotencyTable); err != nil {
+		return err
+	}
+
+	if _, err := o.Db.ExecContext(o.Ctx, deliveriesTable); err != nil {
+		return err
+	}
+
+	// Базы, созданные до появления колонки
+	if err := o.addColumn("expressions", "ast", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := o.addColumn("expressions", "reason", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := o.addColumn("tasks", "args", "TEXT"); err != nil {
+		return err
+	}
+
+	if err := o.addColumn("expressions", "variables", "TEXT"); err != nil {
+		return err
+	}
+
+	for _, column := range [][2]string{
+		{"expressions", "precision"}, {"expressions", "scale"},
+		{"tasks", "precision"}, {"tasks", "scale"}, {"tasks", "exact_args"},
+	} {
+		definition := "TEXT"
+		if column[1] == "scale" {
+			definition = "INTEGER"
+		}
+		if err := o.addColumn(column[0], column[1], definition); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []string{"no_optimize", "priority", "deadline"} {
+		if err := o.addColumn("expressions", column, "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range [][2]string{{"expressions", "callback_url"}, {"users", "webhook_url"}, {"users", "webhook_secret"}} {
+		if err := o.addColumn(column[0], column[1], "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Execer - *sql.DB или *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// store - куда пишутся выражения и задачи: в транзакцию пакета, если она открыта, иначе в базу. Вызывать под o.mu
+func (o *Orchestrator) store() Execer {
+	if o.tx != nil {
+		return o.tx
+	}
+	return o.Db
+}
+
+// addColumn добавляет колонку в уже существующую таблицу
+func (o *Orchestrator) addColumn(table, column, definition string) error {
+	_, err := o.Db.ExecContext(o.Ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil && strings.Contains(err.Error(), "duplicate column name") {
+		return nil
+	}
+	return err
+}
+
 // UTD - Users Table Deleting
 func (o *Orchestrator) UTD(ctx context.Context, lg string, db *sql.DB) error {
 
@@ -112,24 +260,43 @@ func (o *Orchestrator) AddUser(ctx context.Context, lg, hashed string, db *sql.D
 }
 
 func (o *Orchestrator) AddExpr(expr *Expression, rok bool, db *sql.DB) error {
-	var ID int
 	id, err := strconv.Atoi(expr.ID)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sl := `SELECT id FROM users WHERE login = ?`
+	ast, err := json.Marshal(expr.AST)
+	if err != nil {
+		return err
+	}
 
-	o.Db.QueryRowContext(o.Ctx, sl, expr.Login).Scan(&ID)
+	variables, err := json.Marshal(expr.Variables)
+	if err != nil {
+		return err
+	}
 
-	up := `UPDATE expressions SET expression = $1, jwt = $2, user_lg = $3, status = $4, user_id = $5 WHERE id = $6`
+	// Срок храним в миллисекундах Unix, 0 - без срока
+	var deadline int64
+	if expr.Deadline != nil {
+		deadline = expr.Deadline.UnixMilli()
+	}
+
+	// Владелец обычно известен из токена; выражения, созданные в обход него, ищут пользователя по логину
+	ID := expr.UserID
+	if ID == 0 {
+		sl := `SELECT id FROM users WHERE login = ?`
+		o.store().QueryRowContext(o.Ctx, sl, expr.Login).Scan(&ID)
+		expr.UserID = ID
+	}
+
+	up := `UPDATE expressions SET expression = $1, jwt = $2, user_lg = $3, status = $4, user_id = $5, ast = $6, variables = $7, precision = $8, scale = $9, no_optimize = $10, priority = $11, deadline = $12, callback_url = $13 WHERE id = $14`
 
 	if !rok {
-		q := `INSERT INTO expressions(id, expression, jwt, user_lg, status, user_id) VALUES(?, ?, ?, ?, ?, ?)`
-		_, err := o.Db.ExecContext(o.Ctx, q, id, expr.Expr, expr.Jwt, expr.Login, expr.Status, ID)
+		q := `INSERT INTO expressions(id, expression, jwt, user_lg, status, user_id, ast, variables, precision, scale, no_optimize, priority, deadline, callback_url) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err := o.store().ExecContext(o.Ctx, q, id, expr.Expr, expr.Jwt, expr.Login, expr.Status, ID, string(ast), string(variables), expr.Precision, expr.Scale, expr.NoOptimize, expr.Priority, deadline, expr.Callback)
 		if err != nil {
 			if strings.Contains(err.Error(), "UNIQUE constraint failed: expressions.id") {
-				_, err := o.Db.ExecContext(o.Ctx, up, expr.Expr, expr.Jwt, expr.Login, expr.Status, ID, expr.ID)
+				_, err := o.store().ExecContext(o.Ctx, up, expr.Expr, expr.Jwt, expr.Login, expr.Status, ID, string(ast), string(variables), expr.Precision, expr.Scale, expr.NoOptimize, expr.Priority, deadline, expr.Callback, expr.ID)
 				return err
 			}
 			return err
@@ -138,21 +305,231 @@ func (o *Orchestrator) AddExpr(expr *Expression, rok bool, db *sql.DB) error {
 		return nil
 	}
 
-	up = `UPDATE expressions SET status = $1, result = $2 WHERE id = $3 AND user_lg = $4`
-	_, err = o.Db.ExecContext(o.Ctx, up, expr.Status, expr.Result, id, expr.Login)
+	up = `UPDATE expressions SET status = $1, result = $2, ast = $3, reason = $4 WHERE id = $5 AND user_lg = $6`
+	_, err = o.store().ExecContext(o.Ctx, up, expr.Status, expr.Result, string(ast), expr.Reason, id, expr.Login)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *Orchestrator) saveTask(task *Task) error {
+	args, err := json.Marshal(task.Args)
+	if err != nil {
+		return err
+	}
+
+	exactArgs, err := json.Marshal(task.ExactArgs)
+	if err != nil {
+		return err
+	}
+
+	q := `INSERT OR REPLACE INTO tasks(id, expr_id, arg1, arg2, operation, operation_time, args, precision, scale, exact_args) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = o.store().ExecContext(o.Ctx, q, task.ID, task.ExprID, task.Arg1, task.Arg2, task.Operation, task.Operation_time, string(args), task.Precision, task.Scale, string(exactArgs))
+	return err
+}
+
+func (o *Orchestrator) deleteTask(id string) error {
+	_, err := o.store().ExecContext(o.Ctx, `DELETE FROM tasks WHERE id = ?`, id)
+	return err
+}
+
+// LoadExpressions поднимает выражения, их деревья и невыполненные задачи после перезапуска
+func (o *Orchestrator) LoadExpressions() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	rows, err := o.Db.QueryContext(o.Ctx, `SELECT id, expression, jwt, user_lg, user_id, status, result, ast, reason, variables, precision, scale, no_optimize, priority, deadline, callback_url FROM expressions`)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			expr                                      = &Expression{}
+			result, ast, reason, variables, precision sql.NullString
+			scale                                     sql.NullInt64
+			deadline                                  int64
+		)
+		if err = rows.Scan(&expr.ID, &expr.Expr, &expr.Jwt, &expr.Login, &expr.UserID, &expr.Status, &result, &ast, &reason, &variables, &precision, &scale, &expr.NoOptimize, &expr.Priority, &deadline, &expr.Callback); err != nil {
+			return err
+		}
+		if deadline > 0 {
+			d := time.UnixMilli(deadline)
+			expr.Deadline = &d
+		}
+		expr.Result = result.String
+		expr.Reason = reason.String
+		expr.Precision = precision.String
+		expr.Scale = int(scale.Int64)
+
+		if variables.Valid && variables.String != "" {
+			if err = json.Unmarshal([]byte(variables.String), &expr.Variables); err != nil {
+				return fmt.Errorf("expression %s: %w", expr.ID, err)
+			}
+		}
+
+		if ast.Valid && ast.String != "" && ast.String != "null" {
+			if err = json.Unmarshal([]byte(ast.String), &expr.AST); err != nil {
+				return fmt.Errorf("expression %s: %w", expr.ID, err)
+			}
+			if !expr.NoOptimize {
+				// В JSON общий узел записан несколько раз - склеиваем копии обратно
+				expr.AST = shareSubtrees(expr.AST)
+			}
+		} else if !isFinal(expr.Status) {
+			// Дерево не сохранялось - считаем выражение заново
+			if expr.AST, err = prepareAST(expr.Expr, expr.Variables); err != nil {
+				return fmt.Errorf("expression %s: %w", expr.ID, err)
+			}
+			if !expr.NoOptimize {
+				expr.AST = Optimize(expr.AST, expr.Precision)
+			}
+		}
+
+		o.ExprStore[expr.ID] = expr
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	tasks, err := o.loadTasks()
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	ids := make([]int, 0, len(o.ExprStore))
+	for id := range o.ExprStore {
+		n, _ := strconv.Atoi(id)
+		ids = append(ids, n)
+	}
+	sort.Ints(ids)
+
+	for _, n := range ids {
+		expr := o.ExprStore[strconv.Itoa(n)]
+		if isFinal(expr.Status) || expr.AST == nil {
+			continue
+		}
+		bindTasks(expr.AST, byID)
+	}
+
+	for _, task := range tasks {
+		if task.Node == nil {
+			if err = o.deleteTask(task.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		o.taskStore[task.ID] = task
+		task.Login = o.ExprStore[task.ExprID].Login
+		task.Priority = o.ExprStore[task.ExprID].Priority
+		o.queue.push(task)
+	}
+
+	for _, n := range ids {
+		expr := o.ExprStore[strconv.Itoa(n)]
+		if isFinal(expr.Status) || expr.AST == nil {
+			continue
+		}
+		o.Tasks(expr)
+
+		// Оставшиеся узлы могли найтись в кэше
+		if expr.Status == "completed" {
+			if err = o.AddExpr(expr, true, o.Db); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = o.Db.QueryRowContext(o.Ctx, `SELECT COALESCE(MAX(id), 0) FROM expressions`).Scan(&o.ExprCounter); err != nil {
+		return err
+	}
+
+	var taskCounter int
+	if err = o.Db.QueryRowContext(o.Ctx, `SELECT COALESCE(MAX(id), 0) FROM tasks`).Scan(&taskCounter); err != nil {
+		return err
+	}
+	if taskCounter > o.taskCounter {
+		o.taskCounter = taskCounter
+	}
 
 	return nil
 }
 
+// loadTasks читает сохраненные задачи в порядке постановки в очередь
+func (o *Orchestrator) loadTasks() ([]*Task, error) {
+	rows, err := o.Db.QueryContext(o.Ctx, `SELECT id, expr_id, arg1, arg2, operation, operation_time, args, precision, scale, exact_args FROM tasks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*Task, 0)
+	for rows.Next() {
+		var (
+			task                       = &Task{}
+			args, precision, exactArgs sql.NullString
+			scale                      sql.NullInt64
+		)
+		if err = rows.Scan(&task.ID, &task.ExprID, &task.Arg1, &task.Arg2, &task.Operation, &task.Operation_time, &args, &precision, &scale, &exactArgs); err != nil {
+			return nil, err
+		}
+		task.Precision = precision.String
+		task.Scale = int(scale.Int64)
+		if args.Valid && args.String != "" {
+			if err = json.Unmarshal([]byte(args.String), &task.Args); err != nil {
+				return nil, fmt.Errorf("task %s: %w", task.ID, err)
+			}
+		}
+		if exactArgs.Valid && exactArgs.String != "" {
+			if err = json.Unmarshal([]byte(exactArgs.String), &task.ExactArgs); err != nil {
+				return nil, fmt.Errorf("task %s: %w", task.ID, err)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// bindTasks связывает задачи с узлами дерева; узлы без задачи будут запланированы заново.
+// Общий узел (после Optimize) встречается в обходе несколько раз, но задача у него одна
+func bindTasks(node *ASTNode, tasks map[string]*Task) {
+	if node == nil || node.IsLeaf {
+		return
+	}
+
+	for _, child := range node.Children() {
+		bindTasks(child, tasks)
+	}
+
+	if !node.TaskScheduled {
+		return
+	}
+
+	if task, ok := tasks[node.TaskID]; ok && (task.Node == nil || task.Node == node) {
+		task.Node = node
+		return
+	}
+
+	node.TaskScheduled = false
+	node.TaskID = ""
+}
+
 func (o *Orchestrator) SignIn(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var (
-		u User
-		h Hash
+		u  User
+		h  Hash
+		id int64
 	)
 
 	err := json.NewDecoder(r.Body).Decode(&u)
@@ -161,10 +538,10 @@ func (o *Orchestrator) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	q := `SELECT hash FROM users WHERE login = ?`
+	q := `SELECT id, hash FROM users WHERE login = ?`
 	up := `UPDATE users SET jwt= $1 WHERE login = $2`
 
-	err = o.Db.QueryRowContext(o.Ctx, q, u.Login).Scan(&h.hash)
+	err = o.Db.QueryRowContext(o.Ctx, q, u.Login).Scan(&id, &h.hash)
 	if err != nil {
 		if strings.Contains(err.Error(), "no rows in result set") {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -180,13 +557,8 @@ func (o *Orchestrator) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwt := AddJWT(u.Login)
-
-	for _, expr := range o.ExprStore {
-		if expr.Login == u.Login {
-			expr.Jwt = jwt
-		}
-	}
+	// Выражения привязаны к ID пользователя, поэтому после нового входа они по-прежнему доступны
+	jwt := AddJWT(u.Login, id)
 
 	_, err = o.Db.ExecContext(o.Ctx, up, jwt, u.Login)
 	if err != nil {
@@ -0,0 +1,118 @@
+package application
+
+import (
+	"errors"
+	"io"
+	"log"
+
+	pb "github.com/MrM2025/rpforcalc/tree/master/calc_go/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Connect - потоковый канал с агентом: агент один раз сообщает свою мощность,
+// оркестратор присылает задачи, как только они появляются, и принимает результаты в том же потоке
+func (o *Orchestrator) Connect(stream pb.OrchestratorAgentService_ConnectServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	hello := msg.GetHello()
+	if hello == nil {
+		return status.Error(codes.InvalidArgument, "the first message must be hello")
+	}
+
+	capacity := int(hello.Capacity)
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	owner := hello.AgentId
+	if owner == "" {
+		owner = taskOwner(stream.Context())
+	}
+
+	o.mu.Lock()
+	err = o.openStream(owner, agentInstance(stream.Context()), capacity)
+	o.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Agent %s connected with capacity %d", owner, capacity)
+	defer func() {
+		o.mu.Lock()
+		o.closeStream(owner)
+		o.mu.Unlock()
+
+		n := o.releaseOwner(owner)
+		log.Printf("Agent %s disconnected, %d tasks returned to the queue", owner, n)
+	}()
+
+	// Свободные места агента: одно место - одна задача в работе
+	free := make(chan struct{}, capacity)
+	for i := 0; i < capacity; i++ {
+		free <- struct{}{}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				done <- err
+				return
+			}
+
+			result := msg.GetResult()
+			if result == nil {
+				continue
+			}
+
+			if _, err = o.post(result, owner); err != nil {
+				log.Printf("Agent %s: result of task %s rejected: %v", owner, result.Id, err)
+			}
+
+			select {
+			case free <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-free:
+		case err = <-done:
+			return streamEnd(err)
+		}
+
+		for {
+			o.mu.Lock()
+			task := o.take(owner)
+			wake := o.wake
+			o.mu.Unlock()
+
+			if task != nil {
+				if err = stream.Send(&pb.OrchestratorMessage{Task: task.response()}); err != nil {
+					return err
+				}
+				break
+			}
+
+			select {
+			case <-wake:
+			case err = <-done:
+				return streamEnd(err)
+			}
+		}
+	}
+}
+
+func streamEnd(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
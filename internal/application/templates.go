@@ -0,0 +1,169 @@
+package application
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+type Template struct {
+	Name       string   `json:"name"`
+	Expression string   `json:"expression"`
+	Variables  []string `json:"variables,omitempty"` // какие переменные нужно передать при вычислении
+}
+
+type TemplateReq struct {
+	Name       string             `json:"name,omitempty"`
+	Expression string             `json:"expression,omitempty"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Precision  string             `json:"precision,omitempty"`
+	Scale      *int               `json:"scale,omitempty"`
+	NoOptimize bool               `json:"no_optimize,omitempty"`
+	Priority   int                `json:"priority,omitempty"`
+	Deadline   *time.Time         `json:"deadline,omitempty"`
+	Callback   string             `json:"callback_url,omitempty"`
+	JWT        string             `json:"jwt,omitempty"`
+}
+
+type TemplatesResp struct {
+	Templates []*Template `json:"templates"`
+}
+
+// TemplatesHandler - POST сохраняет (или заменяет) шаблон пользователя, GET выводит все его шаблоны
+func (o *Orchestrator) TemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request TemplateReq
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"Invalid Body"}`, http.StatusBadRequest)
+		return
+	}
+
+	id, ok := o.authorize(w, r, "", request.JWT)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		templates, err := o.loadTemplates(id.Login)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+			log.Println(err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(TemplatesResp{Templates: templates})
+		return
+	}
+
+	if request.Name == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(OrchResJSON{Error: "Empty template name"})
+		return
+	}
+
+	ast, err := ParseAST(request.Expression)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(exprErrorResp(err))
+		return
+	}
+
+	q := `INSERT INTO templates(user_lg, name, expression) VALUES(?, ?, ?)
+	ON CONFLICT(user_lg, name) DO UPDATE SET expression = excluded.expression`
+	if _, err = o.Db.ExecContext(o.Ctx, q, id.Login, request.Name, request.Expression); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Template{Name: request.Name, Expression: request.Expression, Variables: Variables(ast)})
+}
+
+// EvaluateTemplate ставит в очередь выражение из шаблона {name} с переданными значениями переменных
+func (o *Orchestrator) EvaluateTemplate(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var request TemplateReq
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"Invalid Body"}`, http.StatusBadRequest)
+		return
+	}
+
+	id, ok := o.authorize(w, r, "", request.JWT)
+	if !ok {
+		return
+	}
+
+	var expression string
+	q := `SELECT expression FROM templates WHERE user_lg = ? AND name = ?`
+	err := o.Db.QueryRowContext(o.Ctx, q, id.Login, r.PathValue("name")).Scan(&expression)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, `{"error":"Template not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+		log.Println(err)
+		return
+	}
+
+	// Дальше - как обычный запрос /api/v1/calculate
+	calc := &OrchReqJSON{
+		Expression: expression,
+		Variables:  request.Variables,
+		Precision:  request.Precision,
+		Scale:      request.Scale,
+		NoOptimize: request.NoOptimize,
+		Priority:   request.Priority,
+		Deadline:   request.Deadline,
+		Callback:   request.Callback,
+		Login:      id.Login,
+		JWT:        id.Token,
+	}
+
+	exprID, status, err := o.accept(calc, id.UserID, r.Header.Get(IdempotencyHeader))
+	writeAccepted(w, exprID, status, err)
+}
+
+func (o *Orchestrator) loadTemplates(login string) ([]*Template, error) {
+	rows, err := o.Db.QueryContext(o.Ctx, `SELECT name, expression FROM templates WHERE user_lg = ? ORDER BY name`, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]*Template, 0)
+	for rows.Next() {
+		template := &Template{}
+		if err = rows.Scan(&template.Name, &template.Expression); err != nil {
+			return nil, err
+		}
+		if ast, err := ParseAST(template.Expression); err == nil {
+			template.Variables = Variables(ast)
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, rows.Err()
+}
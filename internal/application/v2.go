@@ -0,0 +1,162 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Коды ошибок API v2
+const (
+	CodeInvalidBody       = "invalid_body"
+	CodeUnauthorized      = "unauthorized"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeInvalidExpression = "invalid_expression"
+	CodeInternal          = "internal"
+)
+
+// APIError - ошибка в ответах API v2; code не меняется между версиями сервера, message - для человека
+type APIError struct {
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	ParseError *ParseError `json:"parse_error,omitempty"`
+}
+
+// ErrorEnvelope - тело любого ответа API v2 с ошибкой
+type ErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+type ExpressionsResp struct {
+	Expressions []*Expression `json:"expressions"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorEnvelope{Error: APIError{Code: code, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// methodNotAllowed отвечает 405 на все методы пути, кроме allow
+func methodNotAllowed(allow ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed, use "+strings.Join(allow, " or "))
+	}
+}
+
+// bearerIdentity - пользователь из заголовка Authorization: Bearer, который проверил Authenticate; jwt в теле v2 не принимает
+func bearerIdentity(r *http.Request) (Identity, error) {
+	id, ok := identityFrom(r.Context())
+	if !ok {
+		return Identity{}, errors.New("Authorization: Bearer header is required")
+	}
+	return id, nil
+}
+
+// RouterV2 - API v2: ресурсы в пути, чтение через GET без тела, jwt в заголовке Authorization и ошибки в ErrorEnvelope
+func (o *Orchestrator) RouterV2() http.Handler {
+	mux := http.NewServeMux()
+
+	// Пути без метода срабатывают, только если метод не подошел ни к одному из путей выше по специфичности
+	mux.HandleFunc("GET /api/v2/expressions", o.listExpressionsV2)
+	mux.HandleFunc("POST /api/v2/expressions", o.createExpressionV2)
+	mux.HandleFunc("/api/v2/expressions", methodNotAllowed(http.MethodGet, http.MethodPost))
+	mux.HandleFunc("GET /api/v2/expressions/{id}", o.getExpressionV2)
+	mux.HandleFunc("/api/v2/expressions/{id}", methodNotAllowed(http.MethodGet))
+	mux.HandleFunc("/api/v2/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown path "+r.URL.Path)
+	})
+
+	return mux
+}
+
+func (o *Orchestrator) listExpressionsV2(w http.ResponseWriter, r *http.Request) {
+	id, err := bearerIdentity(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	exprs := make([]*Expression, 0)
+	for _, expr := range o.ExprStore {
+		if expr.ownedBy(id) {
+			exprs = append(exprs, expr)
+		}
+	}
+	sort.Slice(exprs, func(i, j int) bool {
+		a, _ := strconv.Atoi(exprs[i].ID)
+		b, _ := strconv.Atoi(exprs[j].ID)
+		return a < b
+	})
+
+	writeJSON(w, http.StatusOK, ExpressionsResp{Expressions: exprs})
+}
+
+func (o *Orchestrator) getExpressionV2(w http.ResponseWriter, r *http.Request) {
+	id, err := bearerIdentity(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	expr, ok := o.ExprStore[r.PathValue("id")]
+	if !ok || !expr.ownedBy(id) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Expression not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ExprResp{Expression: expr})
+}
+
+// createExpressionV2 - как /api/v1/calculate, но login берется из jwt; ответ 201 с заголовком Location
+func (o *Orchestrator) createExpressionV2(w http.ResponseWriter, r *http.Request) {
+	id, err := bearerIdentity(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return
+	}
+
+	request := new(OrchReqJSON)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+	request.Login, request.JWT = id.Login, id.Token
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	exprID, status, err := o.accept(request, id.UserID, r.Header.Get(IdempotencyHeader))
+	switch status {
+	case http.StatusUnprocessableEntity:
+		rsp := exprErrorResp(err)
+		writeJSON(w, status, ErrorEnvelope{Error: APIError{Code: CodeInvalidExpression, Message: rsp.Error, ParseError: rsp.ParseError}})
+	case http.StatusInternalServerError:
+		writeError(w, status, CodeInternal, "Sorry, something went wrong, try again later")
+	default:
+		if status == http.StatusOK {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		w.Header().Set("Location", "/api/v2/expressions/"+exprID)
+		writeJSON(w, status, OrchResJSON{ID: exprID})
+	}
+}
@@ -0,0 +1,390 @@
+package application
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Заголовки запроса вебхука
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature" // sha256=<hex HMAC-SHA256 от "<timestamp>.<тело>">
+	WebhookTimestampHeader = "X-Webhook-Timestamp" // время отправки, секунды Unix
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"  // ID доставки, одинаковый у всех попыток
+	WebhookAttemptHeader   = "X-Webhook-Attempt"
+)
+
+// maxDeliveries - сколько последних попыток доставки выводит /api/v1/webhook/deliveries
+const maxDeliveries = 100
+
+// WebhookPayload - тело запроса, который получает адрес вебхука
+type WebhookPayload struct {
+	Event      string    `json:"event"` // expression.completed или expression.failed
+	ID         string    `json:"id"`
+	Expression string    `json:"expression"`
+	Status     string    `json:"status"`
+	Result     string    `json:"result,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+type WebhookReq struct {
+	URL *string `json:"url,omitempty"` // нет поля - только посмотреть, пустая строка - отключить
+	JWT string  `json:"jwt"`
+}
+
+type WebhookResp struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"` // ключ подписи, общий для вебхуков аккаунта и выражений
+}
+
+type Delivery struct {
+	ID         int64     `json:"id"`
+	Delivery   string    `json:"delivery"`
+	ExprID     string    `json:"expression_id"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+type DeliveriesResp struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+// webhook - одна доставка; попытки повторяются, пока адрес не ответит 2xx
+type webhook struct {
+	id     string
+	login  string
+	exprID string
+	url    string
+	secret string
+	event  string
+	body   []byte
+}
+
+// SignWebhook - подпись, которую получатель сверяет с заголовком X-Webhook-Signature
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var errPrivateCallback = errors.New("callback_url must not point to a local or private address")
+
+// sharedAddress - 100.64.0.0/10 (CGNAT) и 0.0.0.0/8, которые не покрывают методы net.IP
+var sharedAddress = []*net.IPNet{
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+}
+
+// privateIP - адреса, на которые вебхуки не отправляются без WebhookAllowPrivate:
+// loopback, link-local, RFC1918 и fc00::/7, multicast, неуказанный адрес
+func privateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range sharedAddress {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCallback - адрес вебхука должен быть абсолютным http(s) и, без WebhookAllowPrivate, не локальным.
+// Здесь проверяются только localhost и IP в адресе, имена проверяет dialControl после разрешения
+func (o *Orchestrator) checkCallback(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("callback_url must be an absolute http or https URL")
+	}
+	if o.Config.WebhookAllowPrivate {
+		return nil
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errPrivateCallback
+	}
+	if ip := net.ParseIP(host); ip != nil && privateIP(ip) {
+		return errPrivateCallback
+	}
+	return nil
+}
+
+// dialControl проверяет адрес, к которому вебхук действительно подключается, - и после DNS, и после редиректов
+func (o *Orchestrator) dialControl(network, address string, c syscall.RawConn) error {
+	if o.Config.WebhookAllowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+		return errPrivateCallback
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// webhookSecret возвращает ключ подписи пользователя, при первом обращении создает его.
+// Вызывается и из deliver без o.mu, поэтому ключ записывается, только если его еще нет, и перечитывается
+func (o *Orchestrator) webhookSecret(login string) (string, error) {
+	var secret string
+	if err := o.Db.QueryRowContext(o.Ctx, `SELECT webhook_secret FROM users WHERE login = ?`, login).Scan(&secret); err != nil {
+		return "", err
+	}
+	if secret != "" {
+		return secret, nil
+	}
+
+	q := `UPDATE users SET webhook_secret = ? WHERE login = ? AND webhook_secret = ''`
+	if _, err := o.Db.ExecContext(o.Ctx, q, randomHex(32), login); err != nil {
+		return "", err
+	}
+	err := o.Db.QueryRowContext(o.Ctx, `SELECT webhook_secret FROM users WHERE login = ?`, login).Scan(&secret)
+	return secret, err
+}
+
+// notifyWebhook отправляет вебхук о завершении выражения: на адрес из запроса, а если его нет - на адрес аккаунта.
+// Вызывать под o.mu; здесь только снимок выражения, адрес аккаунта и ключ подписи deliver ищет уже без o.mu
+func (o *Orchestrator) notifyWebhook(expr *Expression) {
+	payload := WebhookPayload{
+		Event:      "expression." + expr.Status,
+		ID:         expr.ID,
+		Expression: expr.Expr,
+		Status:     expr.Status,
+		Result:     expr.Result,
+		Reason:     expr.Reason,
+		Time:       time.Now().UTC(),
+	}
+	body, _ := json.Marshal(payload)
+
+	go o.deliver(&webhook{
+		id:     randomHex(8),
+		login:  expr.Login,
+		exprID: expr.ID,
+		url:    expr.Callback,
+		event:  payload.Event,
+		body:   body,
+	})
+}
+
+// deliver отправляет вебхук до WebhookAttempts раз; пауза между попытками удваивается, начиная с WebhookBackoff
+func (o *Orchestrator) deliver(hook *webhook) {
+	if hook.url == "" {
+		o.Db.QueryRowContext(o.Ctx, `SELECT webhook_url FROM users WHERE login = ?`, hook.login).Scan(&hook.url)
+	}
+	if hook.url == "" {
+		return
+	}
+
+	secret, err := o.webhookSecret(hook.login)
+	if err != nil {
+		log.Printf("Webhook of expression %s: %v", hook.exprID, err)
+		return
+	}
+	hook.secret = secret
+
+	// Без прокси и keep-alive: каждая попытка заново разрешает имя и проходит dialControl
+	dialer := &net.Dialer{Control: o.dialControl}
+	client := &http.Client{
+		Timeout:   time.Duration(o.Config.WebhookTimeout) * time.Millisecond,
+		Transport: &http.Transport{DialContext: dialer.DialContext, DisableKeepAlives: true},
+	}
+	backoff := time.Duration(o.Config.WebhookBackoff) * time.Millisecond
+
+	for attempt := 1; attempt <= o.Config.WebhookAttempts; attempt++ {
+		code, err := hook.send(o, client, attempt)
+		o.recordDelivery(hook, attempt, code, err)
+		if err == nil {
+			return
+		}
+		if attempt == o.Config.WebhookAttempts {
+			log.Printf("Webhook %s of expression %s failed after %d attempts: %v", hook.id, hook.exprID, attempt, err)
+			return
+		}
+
+		select {
+		case <-o.Ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (hook *webhook) send(o *Orchestrator, client *http.Client, attempt int) (int, error) {
+	req, err := http.NewRequestWithContext(o.Ctx, http.MethodPost, hook.url, bytes.NewReader(hook.body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.secret, timestamp, hook.body))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookDeliveryHeader, hook.id)
+	req.Header.Set(WebhookAttemptHeader, strconv.Itoa(attempt))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+func (o *Orchestrator) recordDelivery(hook *webhook, attempt, code int, err error) {
+	var reason string
+	if err != nil {
+		reason = err.Error()
+	}
+
+	q := `INSERT INTO webhook_deliveries(delivery, user_lg, expr_id, url, event, attempt, status_code, error, created_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := o.Db.ExecContext(o.Ctx, q, hook.id, hook.login, hook.exprID, hook.url, hook.event, attempt, code, reason, time.Now().UnixMilli()); err != nil {
+		log.Printf("Saving webhook %s attempt %d error: %v", hook.id, attempt, err)
+	}
+}
+
+// WebhookHandler - GET показывает адрес вебхука аккаунта и ключ подписи, POST меняет адрес
+func (o *Orchestrator) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request WebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"Invalid Body"}`, http.StatusBadRequest)
+		return
+	}
+
+	id, ok := o.authorize(w, r, "", request.JWT)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPost && request.URL != nil {
+		if *request.URL != "" {
+			if err := o.checkCallback(*request.URL); err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(OrchResJSON{Error: err.Error()})
+				return
+			}
+		}
+
+		if _, err := o.Db.ExecContext(o.Ctx, `UPDATE users SET webhook_url = ? WHERE login = ?`, *request.URL, id.Login); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+			log.Println(err)
+			return
+		}
+	}
+
+	var (
+		rsp WebhookResp
+		err error
+	)
+	o.Db.QueryRowContext(o.Ctx, `SELECT webhook_url FROM users WHERE login = ?`, id.Login).Scan(&rsp.URL)
+	if rsp.Secret, err = o.webhookSecret(id.Login); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rsp)
+}
+
+// DeliveriesOutput выводит последние попытки доставки вебхуков пользователя, новые первыми
+func (o *Orchestrator) DeliveriesOutput(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var request WebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"Invalid Body"}`, http.StatusBadRequest)
+		return
+	}
+
+	login, err := requestLogin(r, request.JWT)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode("Session time is up, please, sign in again")
+		return
+	}
+
+	deliveries, err := o.loadDeliveries(login)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(`Sorry, something went wrong, try again later`)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(DeliveriesResp{Deliveries: deliveries})
+}
+
+func (o *Orchestrator) loadDeliveries(login string) ([]Delivery, error) {
+	q := `SELECT id, delivery, expr_id, url, event, attempt, status_code, error, created_at FROM webhook_deliveries WHERE user_lg = ? ORDER BY id DESC LIMIT ?`
+	rows, err := o.Db.QueryContext(o.Ctx, q, login, maxDeliveries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]Delivery, 0)
+	for rows.Next() {
+		var (
+			d         Delivery
+			createdAt int64
+		)
+		if err = rows.Scan(&d.ID, &d.Delivery, &d.ExprID, &d.URL, &d.Event, &d.Attempt, &d.StatusCode, &d.Error, &createdAt); err != nil {
+			return nil, err
+		}
+		d.Time = time.UnixMilli(createdAt)
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
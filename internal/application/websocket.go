@@ -0,0 +1,192 @@
+package application
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// Типы сообщений WebSocket
+const (
+	WSAuth     = "auth"     // клиент: вход по login и jwt; сервер: вход выполнен
+	WSSubmit   = "submit"   // клиент: выражение, поля как у /api/v1/calculate
+	WSAccepted = "accepted" // сервер: выражение принято, в id его ID
+	WSResult   = "result"   // сервер: выражение завершилось (completed, failed, cancelled или timed_out)
+	WSError    = "error"    // сервер: сообщение клиента не принято
+)
+
+// WSRequest - сообщение клиента. ref клиент выбирает сам, сервер возвращает его в ответах на это сообщение
+type WSRequest struct {
+	Type string `json:"type"`
+	Ref  string `json:"ref,omitempty"`
+	OrchReqJSON
+}
+
+type WSResponse struct {
+	Type       string      `json:"type"`
+	Ref        string      `json:"ref,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Result     string      `json:"result,omitempty"`
+	Reason     string      `json:"reason,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	ParseError *ParseError `json:"parse_error,omitempty"`
+}
+
+// wsConn - соединение одного клиента. Ответы на сообщения и результаты пишутся из разных горутин, поэтому запись под mu
+type wsConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+
+	id  Identity
+	sub *subscriber
+
+	// refs - выражения этого соединения, которые еще не завершились: ID -> ref
+	refsMu sync.Mutex
+	refs   map[string]string
+}
+
+func (c *wsConn) send(rsp WSResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.JSON.Send(c.ws, rsp)
+}
+
+// WebSocket - соединение, в котором клиент один раз входит, отправляет выражения и получает их результаты
+func (o *Orchestrator) WebSocket() websocket.Handler {
+	return func(ws *websocket.Conn) {
+		defer ws.Close()
+		ws.MaxPayloadBytes = MaxBodyBytes
+
+		c := &wsConn{ws: ws, refs: make(map[string]string)}
+		defer func() {
+			if c.sub != nil {
+				o.events.unsubscribe(c.sub)
+			}
+		}()
+
+		// Клиент, приславший Authorization при подключении, уже вошел и получает auth сразу
+		if id, ok := identityFrom(ws.Request().Context()); ok {
+			if err := o.wsAuth(c, WSRequest{Type: WSAuth, OrchReqJSON: OrchReqJSON{Login: id.Login, JWT: id.Token}}); err != nil {
+				return
+			}
+		}
+
+		for {
+			var request WSRequest
+			if err := websocket.JSON.Receive(ws, &request); err != nil {
+				if !errors.Is(err, io.EOF) {
+					log.Printf("WebSocket of %s closed: %v", c.id.Login, err)
+				}
+				return
+			}
+
+			var err error
+			switch request.Type {
+			case WSAuth:
+				err = o.wsAuth(c, request)
+			case WSSubmit:
+				err = o.wsSubmit(c, request)
+			default:
+				err = c.send(WSResponse{Type: WSError, Ref: request.Ref, Error: "unknown message type"})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (o *Orchestrator) wsAuth(c *wsConn, request WSRequest) error {
+	if c.sub != nil {
+		return c.send(WSResponse{Type: WSError, Ref: request.Ref, Error: "already signed in"})
+	}
+
+	o.mu.Lock()
+	err := o.verifySession(request.Login, request.JWT)
+	o.mu.Unlock()
+	if err != nil {
+		return c.send(WSResponse{Type: WSError, Ref: request.Ref, Error: err.Error()})
+	}
+
+	// verifySession уже проверил токен
+	c.id, _ = parseJWT(request.JWT)
+	c.sub = o.events.subscribe(c.id.UserID, "")
+	go o.wsResults(c)
+
+	return c.send(WSResponse{Type: WSAuth, Ref: request.Ref})
+}
+
+func (o *Orchestrator) wsSubmit(c *wsConn, request WSRequest) error {
+	if c.sub == nil {
+		return c.send(WSResponse{Type: WSError, Ref: request.Ref, Error: "sign in first"})
+	}
+
+	req := request.OrchReqJSON
+	req.Login, req.JWT = c.id.Login, c.id.Token
+
+	o.mu.Lock()
+	expr, err := o.newExpression(&req, c.id.UserID)
+	if err != nil {
+		o.mu.Unlock()
+		rsp := exprErrorResp(err)
+		return c.send(WSResponse{Type: WSError, Ref: request.Ref, Error: rsp.Error, ParseError: rsp.ParseError})
+	}
+
+	if err = o.submit(expr); err != nil {
+		o.mu.Unlock()
+		log.Println(err)
+		return c.send(WSResponse{Type: WSError, Ref: request.Ref, Error: "Sorry, something went wrong, try again later"})
+	}
+
+	// Завершенное сразу (свернулось к числу или взято из кэша) выражение отправляем отсюда, остальные - wsResults.
+	// Запись захватываем до o.mu.Unlock: результат, опубликованный позже, не обгонит accepted
+	final := isFinal(expr.Status)
+	result := expressionResult(expr, request.Ref)
+	if !final {
+		c.refsMu.Lock()
+		c.refs[expr.ID] = request.Ref
+		c.refsMu.Unlock()
+	}
+	c.mu.Lock()
+	o.mu.Unlock()
+	defer c.mu.Unlock()
+
+	if err = websocket.JSON.Send(c.ws, WSResponse{Type: WSAccepted, Ref: request.Ref, ID: expr.ID}); err != nil || !final {
+		return err
+	}
+	return websocket.JSON.Send(c.ws, result)
+}
+
+// wsResults пересылает клиенту результаты его выражений, пока соединение открыто
+func (o *Orchestrator) wsResults(c *wsConn) {
+	for event := range c.sub.ch {
+		if event.Type != EventStatus || !isFinal(event.Status) {
+			continue
+		}
+
+		c.refsMu.Lock()
+		ref, ok := c.refs[event.ExprID]
+		delete(c.refs, event.ExprID)
+		c.refsMu.Unlock()
+		if !ok {
+			continue
+		}
+
+		rsp := WSResponse{Type: WSResult, Ref: ref, ID: event.ExprID, Status: event.Status, Result: event.Result, Reason: event.Reason}
+		if err := c.send(rsp); err != nil {
+			c.ws.Close()
+			return
+		}
+	}
+
+	// Канал закрыт: клиент не успевал читать события. Без результатов соединение бесполезно
+	c.ws.Close()
+}
+
+func expressionResult(expr *Expression, ref string) WSResponse {
+	return WSResponse{Type: WSResult, Ref: ref, ID: expr.ID, Status: expr.Status, Result: expr.Result, Reason: expr.Reason}
+}
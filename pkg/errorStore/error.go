@@ -7,8 +7,11 @@ import (
 var (
 	EmptyExpressionErr     = errors.New(`empty expression`)
 	IncorrectExpressionErr = errors.New(`incorrect expression`)
-	NumToPopMErr           = errors.New(`numtopop > length of slice of nums`)
-	NumToPopZeroErr        = errors.New(`numtopop <= 0`)
-	NthToPopErr            = errors.New(`no operator to pop`)
 	DvsByZeroErr           = errors.New(`division by zero`)
+	UnknownOperatorErr     = errors.New(`unknown operator`)
+	OutOfDomainErr         = errors.New(`result is not a real number`)
+	UnboundVariableErr     = errors.New(`unbound variable`)
+	LeaseExpiredErr        = errors.New(`task lease expired`)
+	LeaseMismatchErr       = errors.New(`task is leased by another agent`)
+	IdempotencyKeyErr      = errors.New(`idempotency key was already used with a different request`)
 )
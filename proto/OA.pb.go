@@ -64,6 +64,11 @@ type GetResponse struct {
 	Arg2          float64                `protobuf:"fixed64,4,opt,name=arg2,proto3" json:"arg2,omitempty"`
 	Operation     string                 `protobuf:"bytes,5,opt,name=operation,proto3" json:"operation,omitempty"`
 	OperationTime int32                  `protobuf:"varint,6,opt,name=operation_time,json=operationTime,proto3" json:"operation_time,omitempty"`
+	LeaseId       string                 `protobuf:"bytes,7,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	Args          []float64              `protobuf:"fixed64,8,rep,packed,name=args,proto3" json:"args,omitempty"`
+	Precision     string                 `protobuf:"bytes,9,opt,name=precision,proto3" json:"precision,omitempty"`
+	Scale         int32                  `protobuf:"varint,10,opt,name=scale,proto3" json:"scale,omitempty"`
+	ExactArgs     []string               `protobuf:"bytes,11,rep,name=exact_args,json=exactArgs,proto3" json:"exact_args,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -133,17 +138,107 @@ func (x *GetResponse) GetOperationTime() int32 {
 	return 0
 }
 
+func (x *GetResponse) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *GetResponse) GetArgs() []float64 {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *GetResponse) GetPrecision() string {
+	if x != nil {
+		return x.Precision
+	}
+	return ""
+}
+
+func (x *GetResponse) GetScale() int32 {
+	if x != nil {
+		return x.Scale
+	}
+	return 0
+}
+
+func (x *GetResponse) GetExactArgs() []string {
+	if x != nil {
+		return x.ExactArgs
+	}
+	return nil
+}
+
+type TaskError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskError) Reset() {
+	*x = TaskError{}
+	mi := &file_proto_OA_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskError) ProtoMessage() {}
+
+func (x *TaskError) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskError.ProtoReflect.Descriptor instead.
+func (*TaskError) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TaskError) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *TaskError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
 type PostRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Result        float64                `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
+	LeaseId       string                 `protobuf:"bytes,3,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	Error         *TaskError             `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	ExactResult   string                 `protobuf:"bytes,5,opt,name=exact_result,json=exactResult,proto3" json:"exact_result,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PostRequest) Reset() {
 	*x = PostRequest{}
-	mi := &file_proto_OA_proto_msgTypes[2]
+	mi := &file_proto_OA_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -155,7 +250,7 @@ func (x *PostRequest) String() string {
 func (*PostRequest) ProtoMessage() {}
 
 func (x *PostRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_OA_proto_msgTypes[2]
+	mi := &file_proto_OA_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -168,7 +263,7 @@ func (x *PostRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PostRequest.ProtoReflect.Descriptor instead.
 func (*PostRequest) Descriptor() ([]byte, []int) {
-	return file_proto_OA_proto_rawDescGZIP(), []int{2}
+	return file_proto_OA_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PostRequest) GetId() string {
@@ -185,24 +280,407 @@ func (x *PostRequest) GetResult() float64 {
 	return 0
 }
 
+func (x *PostRequest) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *PostRequest) GetError() *TaskError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *PostRequest) GetExactResult() string {
+	if x != nil {
+		return x.ExactResult
+	}
+	return ""
+}
+
+type Hello struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Capacity      int32                  `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_proto_OA_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Hello) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *Hello) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*AgentMessage_Hello
+	//	*AgentMessage_Result
+	Payload       isAgentMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_proto_OA_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AgentMessage) GetPayload() isAgentMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetHello() *Hello {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Hello); ok {
+			return x.Hello
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetResult() *PostRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isAgentMessage_Payload interface {
+	isAgentMessage_Payload()
+}
+
+type AgentMessage_Hello struct {
+	Hello *Hello `protobuf:"bytes,1,opt,name=hello,proto3,oneof"`
+}
+
+type AgentMessage_Result struct {
+	Result *PostRequest `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*AgentMessage_Hello) isAgentMessage_Payload() {}
+
+func (*AgentMessage_Result) isAgentMessage_Payload() {}
+
+type OrchestratorMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Task          *GetResponse           `protobuf:"bytes,1,opt,name=task,proto3" json:"task,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrchestratorMessage) Reset() {
+	*x = OrchestratorMessage{}
+	mi := &file_proto_OA_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrchestratorMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrchestratorMessage) ProtoMessage() {}
+
+func (x *OrchestratorMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrchestratorMessage.ProtoReflect.Descriptor instead.
+func (*OrchestratorMessage) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *OrchestratorMessage) GetTask() *GetResponse {
+	if x != nil {
+		return x.Task
+	}
+	return nil
+}
+
+type RegisterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Capacity      int32                  `protobuf:"varint,3,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterRequest) Reset() {
+	*x = RegisterRequest{}
+	mi := &file_proto_OA_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterRequest) ProtoMessage() {}
+
+func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *RegisterRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *RegisterRequest) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+type RegisterResponse struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	HeartbeatIntervalMs int32                  `protobuf:"varint,1,opt,name=heartbeat_interval_ms,json=heartbeatIntervalMs,proto3" json:"heartbeat_interval_ms,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_proto_OA_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RegisterResponse) GetHeartbeatIntervalMs() int32 {
+	if x != nil {
+		return x.HeartbeatIntervalMs
+	}
+	return 0
+}
+
+type HeartbeatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_proto_OA_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_OA_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_OA_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *HeartbeatRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
 var File_proto_OA_proto protoreflect.FileDescriptor
 
 const file_proto_OA_proto_rawDesc = "" +
 	"\n" +
 	"\x0eproto/OA.proto\x12\x05proto\"\a\n" +
-	"\x05Empty\"\x8a\x01\n" +
+	"\x05Empty\"\x8c\x02\n" +
 	"\vGetResponse\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04arg1\x18\x03 \x01(\x01R\x04arg1\x12\x12\n" +
 	"\x04arg2\x18\x04 \x01(\x01R\x04arg2\x12\x1c\n" +
 	"\toperation\x18\x05 \x01(\tR\toperation\x12%\n" +
-	"\x0eoperation_time\x18\x06 \x01(\x05R\roperationTime\"5\n" +
+	"\x0eoperation_time\x18\x06 \x01(\x05R\roperationTime\x12\x19\n" +
+	"\blease_id\x18\a \x01(\tR\aleaseId\x12\x12\n" +
+	"\x04args\x18\b \x03(\x01R\x04args\x12\x1c\n" +
+	"\tprecision\x18\t \x01(\tR\tprecision\x12\x14\n" +
+	"\x05scale\x18\n" +
+	" \x01(\x05R\x05scale\x12\x1d\n" +
+	"\n" +
+	"exact_args\x18\v \x03(\tR\texactArgs\"9\n" +
+	"\tTaskError\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x9b\x01\n" +
 	"\vPostRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
-	"\x06result\x18\x02 \x01(\x01R\x06result2q\n" +
+	"\x06result\x18\x02 \x01(\x01R\x06result\x12\x19\n" +
+	"\blease_id\x18\x03 \x01(\tR\aleaseId\x12&\n" +
+	"\x05error\x18\x04 \x01(\v2\x10.proto.TaskErrorR\x05error\x12!\n" +
+	"\fexact_result\x18\x05 \x01(\tR\vexactResult\">\n" +
+	"\x05Hello\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1a\n" +
+	"\bcapacity\x18\x02 \x01(\x05R\bcapacity\"m\n" +
+	"\fAgentMessage\x12$\n" +
+	"\x05hello\x18\x01 \x01(\v2\f.proto.HelloH\x00R\x05hello\x12,\n" +
+	"\x06result\x18\x02 \x01(\v2\x12.proto.PostRequestH\x00R\x06resultB\t\n" +
+	"\apayload\"=\n" +
+	"\x13OrchestratorMessage\x12&\n" +
+	"\x04task\x18\x01 \x01(\v2\x12.proto.GetResponseR\x04task\"\xbf\x01\n" +
+	"\x0fRegisterRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12:\n" +
+	"\x06labels\x18\x02 \x03(\v2\".proto.RegisterRequest.LabelsEntryR\x06labels\x12\x1a\n" +
+	"\bcapacity\x18\x03 \x01(\x05R\bcapacity\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"F\n" +
+	"\x10RegisterResponse\x122\n" +
+	"\x15heartbeat_interval_ms\x18\x01 \x01(\x05R\x13heartbeatIntervalMs\"-\n" +
+	"\x10HeartbeatRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId2\xa8\x02\n" +
 	"\x18OrchestratorAgentService\x12)\n" +
 	"\x03Get\x12\f.proto.Empty\x1a\x12.proto.GetResponse\"\x00\x12*\n" +
-	"\x04Post\x12\x12.proto.PostRequest\x1a\f.proto.Empty\"\x00B8Z6github.com/MrM2025/rpforcalc/tree/master/calc_go/protob\x06proto3"
+	"\x04Post\x12\x12.proto.PostRequest\x1a\f.proto.Empty\"\x00\x12@\n" +
+	"\aConnect\x12\x13.proto.AgentMessage\x1a\x1a.proto.OrchestratorMessage\"\x00(\x010\x01\x12=\n" +
+	"\bRegister\x12\x16.proto.RegisterRequest\x1a\x17.proto.RegisterResponse\"\x00\x124\n" +
+	"\tHeartbeat\x12\x17.proto.HeartbeatRequest\x1a\f.proto.Empty\"\x00B8Z6github.com/MrM2025/rpforcalc/tree/master/calc_go/protob\x06proto3"
 
 var (
 	file_proto_OA_proto_rawDescOnce sync.Once
@@ -216,22 +694,41 @@ func file_proto_OA_proto_rawDescGZIP() []byte {
 	return file_proto_OA_proto_rawDescData
 }
 
-var file_proto_OA_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_OA_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_proto_OA_proto_goTypes = []any{
-	(*Empty)(nil),       // 0: proto.Empty
-	(*GetResponse)(nil), // 1: proto.GetResponse
-	(*PostRequest)(nil), // 2: proto.PostRequest
+	(*Empty)(nil),               // 0: proto.Empty
+	(*GetResponse)(nil),         // 1: proto.GetResponse
+	(*TaskError)(nil),           // 2: proto.TaskError
+	(*PostRequest)(nil),         // 3: proto.PostRequest
+	(*Hello)(nil),               // 4: proto.Hello
+	(*AgentMessage)(nil),        // 5: proto.AgentMessage
+	(*OrchestratorMessage)(nil), // 6: proto.OrchestratorMessage
+	(*RegisterRequest)(nil),     // 7: proto.RegisterRequest
+	(*RegisterResponse)(nil),    // 8: proto.RegisterResponse
+	(*HeartbeatRequest)(nil),    // 9: proto.HeartbeatRequest
+	nil,                         // 10: proto.RegisterRequest.LabelsEntry
 }
 var file_proto_OA_proto_depIdxs = []int32{
-	0, // 0: proto.OrchestratorAgentService.Get:input_type -> proto.Empty
-	2, // 1: proto.OrchestratorAgentService.Post:input_type -> proto.PostRequest
-	1, // 2: proto.OrchestratorAgentService.Get:output_type -> proto.GetResponse
-	0, // 3: proto.OrchestratorAgentService.Post:output_type -> proto.Empty
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	2,  // 0: proto.PostRequest.error:type_name -> proto.TaskError
+	4,  // 1: proto.AgentMessage.hello:type_name -> proto.Hello
+	3,  // 2: proto.AgentMessage.result:type_name -> proto.PostRequest
+	1,  // 3: proto.OrchestratorMessage.task:type_name -> proto.GetResponse
+	10, // 4: proto.RegisterRequest.labels:type_name -> proto.RegisterRequest.LabelsEntry
+	0,  // 5: proto.OrchestratorAgentService.Get:input_type -> proto.Empty
+	3,  // 6: proto.OrchestratorAgentService.Post:input_type -> proto.PostRequest
+	5,  // 7: proto.OrchestratorAgentService.Connect:input_type -> proto.AgentMessage
+	7,  // 8: proto.OrchestratorAgentService.Register:input_type -> proto.RegisterRequest
+	9,  // 9: proto.OrchestratorAgentService.Heartbeat:input_type -> proto.HeartbeatRequest
+	1,  // 10: proto.OrchestratorAgentService.Get:output_type -> proto.GetResponse
+	0,  // 11: proto.OrchestratorAgentService.Post:output_type -> proto.Empty
+	6,  // 12: proto.OrchestratorAgentService.Connect:output_type -> proto.OrchestratorMessage
+	8,  // 13: proto.OrchestratorAgentService.Register:output_type -> proto.RegisterResponse
+	0,  // 14: proto.OrchestratorAgentService.Heartbeat:output_type -> proto.Empty
+	10, // [10:15] is the sub-list for method output_type
+	5,  // [5:10] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_OA_proto_init() }
@@ -239,13 +736,17 @@ func file_proto_OA_proto_init() {
 	if File_proto_OA_proto != nil {
 		return
 	}
+	file_proto_OA_proto_msgTypes[5].OneofWrappers = []any{
+		(*AgentMessage_Hello)(nil),
+		(*AgentMessage_Result)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_OA_proto_rawDesc), len(file_proto_OA_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
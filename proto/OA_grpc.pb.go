@@ -19,8 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	OrchestratorAgentService_Get_FullMethodName  = "/proto.OrchestratorAgentService/Get"
-	OrchestratorAgentService_Post_FullMethodName = "/proto.OrchestratorAgentService/Post"
+	OrchestratorAgentService_Get_FullMethodName       = "/proto.OrchestratorAgentService/Get"
+	OrchestratorAgentService_Post_FullMethodName      = "/proto.OrchestratorAgentService/Post"
+	OrchestratorAgentService_Connect_FullMethodName   = "/proto.OrchestratorAgentService/Connect"
+	OrchestratorAgentService_Register_FullMethodName  = "/proto.OrchestratorAgentService/Register"
+	OrchestratorAgentService_Heartbeat_FullMethodName = "/proto.OrchestratorAgentService/Heartbeat"
 )
 
 // OrchestratorAgentServiceClient is the client API for OrchestratorAgentService service.
@@ -29,6 +32,9 @@ const (
 type OrchestratorAgentServiceClient interface {
 	Get(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetResponse, error)
 	Post(ctx context.Context, in *PostRequest, opts ...grpc.CallOption) (*Empty, error)
+	Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage], error)
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*Empty, error)
 }
 
 type orchestratorAgentServiceClient struct {
@@ -59,12 +65,48 @@ func (c *orchestratorAgentServiceClient) Post(ctx context.Context, in *PostReque
 	return out, nil
 }
 
+func (c *orchestratorAgentServiceClient) Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrchestratorAgentService_ServiceDesc.Streams[0], OrchestratorAgentService_Connect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AgentMessage, OrchestratorMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrchestratorAgentService_ConnectClient = grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage]
+
+func (c *orchestratorAgentServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, OrchestratorAgentService_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorAgentServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, OrchestratorAgentService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // OrchestratorAgentServiceServer is the server API for OrchestratorAgentService service.
 // All implementations must embed UnimplementedOrchestratorAgentServiceServer
 // for forward compatibility.
 type OrchestratorAgentServiceServer interface {
 	Get(context.Context, *Empty) (*GetResponse, error)
 	Post(context.Context, *PostRequest) (*Empty, error)
+	Connect(grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]) error
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*Empty, error)
 	mustEmbedUnimplementedOrchestratorAgentServiceServer()
 }
 
@@ -81,6 +123,15 @@ func (UnimplementedOrchestratorAgentServiceServer) Get(context.Context, *Empty)
 func (UnimplementedOrchestratorAgentServiceServer) Post(context.Context, *PostRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Post not implemented")
 }
+func (UnimplementedOrchestratorAgentServiceServer) Connect(grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedOrchestratorAgentServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedOrchestratorAgentServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
 func (UnimplementedOrchestratorAgentServiceServer) mustEmbedUnimplementedOrchestratorAgentServiceServer() {
 }
 func (UnimplementedOrchestratorAgentServiceServer) testEmbeddedByValue() {}
@@ -139,6 +190,49 @@ func _OrchestratorAgentService_Post_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OrchestratorAgentService_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OrchestratorAgentServiceServer).Connect(&grpc.GenericServerStream[AgentMessage, OrchestratorMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrchestratorAgentService_ConnectServer = grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]
+
+func _OrchestratorAgentService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorAgentServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrchestratorAgentService_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorAgentServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorAgentService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorAgentServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrchestratorAgentService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorAgentServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // OrchestratorAgentService_ServiceDesc is the grpc.ServiceDesc for OrchestratorAgentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -154,7 +248,22 @@ var OrchestratorAgentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Post",
 			Handler:    _OrchestratorAgentService_Post_Handler,
 		},
+		{
+			MethodName: "Register",
+			Handler:    _OrchestratorAgentService_Register_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _OrchestratorAgentService_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _OrchestratorAgentService_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/OA.proto",
 }